@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -9,6 +10,7 @@ import (
 
 	"0lvl/config"
 	"0lvl/internal/endpoint"
+	"0lvl/internal/inspector"
 	"0lvl/internal/receiver"
 	"0lvl/internal/repository"
 
@@ -23,7 +25,6 @@ func createLogger() zerolog.Logger {
 }
 
 func main() {
-	ctx, ctxCancel := context.WithCancel(context.Background())
 	log := createLogger()
 
 	var cfg config.Config
@@ -31,30 +32,55 @@ func main() {
 		log.Fatal().Err(err).Msg("fail read config")
 	}
 
-	repo, err := repository.New(ctx, cfg, log)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:], cfg, log))
+		case "migrate":
+			os.Exit(migrate(os.Args[2:], cfg, log))
+		}
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	repo, err := newRepo(ctx, cfg, true, log)
 	if err != nil {
 		log.Fatal().Err(err).Msg("fail new repository")
 	}
 
-	log.Info().Msg("start cache warm up")
-	repo.СacheWarmUp()
-	// Если не ждать процесс заполнения кеша
-	// Это может вытеснить более свежие заказы добавленные
-	// ресивером более старыми из базы данных
-	log.Info().Msg("done cache warm up")
+	schemas, transform := newInspection(cfg, log)
+
+	// Снимок, снятый с другими схемами или DROP_FIELDS, MASK_FIELDS,
+	// отбрасывается, кеш прогревается из базы.
+	loaded := false
+	if cfg.CacheSnapshot != "" {
+		err := repo.LoadCacheSnapshot(cfg.CacheSnapshot, transform.Fingerprint())
+		if err != nil {
+			log.Warn().Err(err).Msg("fail load cache snapshot")
+		}
+		loaded = err == nil
+	}
+
+	if !loaded {
+		log.Info().Msg("start cache warm up")
+		repo.СacheWarmUp()
+		// Если не ждать процесс заполнения кеша
+		// Это может вытеснить более свежие заказы добавленные
+		// ресивером более старыми из базы данных
+		log.Info().Msg("done cache warm up")
+	}
 
-	rec, err := receiver.New(repo, cfg, log)
+	rec, err := receiver.New(repo, schemas, transform, cfg, log)
 	if err != nil {
 		log.Fatal().Err(err).Msg("fail new receiver")
 	}
-	defer rec.Close()
-    
+
 	err = rec.Run()
 	if err != nil {
 		log.Fatal().Err(err).Msg("fail run receiver")
 	}
 
-	e := endpoint.New(repo, log)
+	e := endpoint.New(repo, schemas, transform, rec, rec.HTTPSource(), cfg.AdminAddr, log)
 	go e.Run()
 
 	log.Info().Msg("starting http service")
@@ -62,10 +88,110 @@ func main() {
 	signals := make(chan os.Signal, 2)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
 
-	for {
-		sign := <-signals
-		ctxCancel()
-		log.Info().Str("signal", sign.String()).Msg("stoping service")
-		break
+	sign := <-signals
+	ctxCancel()
+	log.Info().Str("signal", sign.String()).Msg("stoping service")
+
+	shutdown(rec, e, repo, transform, cfg, log)
+}
+
+// newRepo создает хранилище cfg.Store и репозиторий над ним.
+// С базой, в которой применены не все миграции, не работает.
+// С cfg.Normalize и backfill сначала раскладывает заказы, сохраненные
+// без него, без cfg.Normalize отмечает, что их придется раскладывать.
+func newRepo(ctx context.Context, cfg config.Config, backfill bool, log zerolog.Logger) (*repository.Repo, error) {
+	var store repository.OrderStore
+	switch cfg.Store {
+	case repository.StorePostgres:
+		pg, err := repository.NewPgStore(ctx, cfg, log)
+		if err != nil {
+			return nil, err
+		}
+		if err := pg.CheckMigrations(ctx); err != nil {
+			pg.Close()
+			return nil, err
+		}
+		switch {
+		case !cfg.Normalize:
+			if err := pg.ForgetBackfill(ctx); err != nil {
+				pg.Close()
+				return nil, err
+			}
+		case backfill:
+			n, err := pg.Backfill(ctx)
+			if err != nil {
+				pg.Close()
+				return nil, err
+			}
+			log.Info().Int64("count orders", n).Msg("normalized tables backfilled")
+		}
+		store = pg
+	case repository.StoreMemory:
+		log.Warn().Msg("orders are kept in memory and lost on stop")
+		store = repository.NewMemStore()
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+
+	repo, err := repository.New(store, log)
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
+	return repo, nil
+}
+
+// newInspection создает реестр версий схемы из cfg.SchemaFiles
+// с пределами из cfg и Transformer. Реестр общий на всех подписчиков,
+// чтобы счетчики версий были общими.
+func newInspection(cfg config.Config, log zerolog.Logger) (*inspector.Registry, *inspector.Transformer) {
+	schemas := inspector.NewRegistry()
+	for _, s := range cfg.SchemaFiles {
+		if err := schemas.RegisterFile(s); err != nil {
+			log.Fatal().Err(err).Msg("fail read config")
+		}
+	}
+	schemas.SetDefaultLimits(inspector.Limits{
+		MaxBytes: cfg.MaxOrderBytes,
+		MaxItems: cfg.MaxOrderItems,
+	})
+	for _, s := range cfg.SchemaLimits {
+		version, limits, err := inspector.ParseLimits(s)
+		if err != nil {
+			log.Fatal().Err(err).Msg("fail read config")
+		}
+		if err := schemas.SetLimits(version, limits); err != nil {
+			log.Fatal().Err(err).Msg("fail read config")
+		}
+	}
+
+	transform, err := inspector.NewTransformer(schemas, cfg.DropFields, cfg.MaskFields)
+	if err != nil {
+		log.Fatal().Err(err).Msg("fail new transformer")
+	}
+	return schemas, transform
+}
+
+// shutdown останавливает сервис за cfg.ShutdownTimeout:
+// сначала прием заказов, чтобы накопители слили пакеты,
+// затем HTTP, снимок кеша и пул подключений к базе.
+func shutdown(rec *receiver.Receiver, e *endpoint.Endpoint, repo *repository.Repo, transform *inspector.Transformer, cfg config.Config, log zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := rec.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("receiver shutdown")
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("http shutdown")
+	}
+
+	if cfg.CacheSnapshot != "" {
+		if err := repo.SaveCacheSnapshot(cfg.CacheSnapshot, transform.Fingerprint()); err != nil {
+			log.Error().Err(err).Msg("fail save cache snapshot")
+		}
+	}
+	repo.Close()
+
+	log.Info().Msg("service stopped")
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/repository"
+
+	"github.com/rs/zerolog"
+)
+
+const migrateUsage = `orderstorage migrate up|down [-n 1]|status
+
+up      применяет все непримененные миграции;
+down    откатывает n последних примененных, 0001_trade не откатывается;
+status  показывает, какие миграции применены.
+
+Миграции встроены в сборку, таблица учета — schema_migrations.
+Сервис не стартует, пока применены не все, и с базой,
+в которой есть миграции новее сборки.
+`
+
+// migrate — подкоманда orderstorage migrate, возвращает код выхода.
+func migrate(args []string, cfg config.Config, log zerolog.Logger) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	steps := fs.Int("n", 1, "сколько миграций откатить в down")
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *steps < 1 {
+		log.Error().Int("n", *steps).Msg("bad -n")
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	store, err := repository.NewPgStore(ctx, cfg, log)
+	if err != nil {
+		log.Error().Err(err).Msg("fail new repository")
+		return 1
+	}
+	defer store.Close()
+
+	var done []repository.Migration
+	switch cmd {
+	case "up":
+		done, err = store.MigrateUp(ctx)
+	case "down":
+		done, err = store.MigrateDown(ctx, *steps)
+	case "status":
+		return migrateStatus(ctx, store, log)
+	case "-h", "--help", "help":
+		fs.Usage()
+		return 0
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	for _, m := range done {
+		log.Info().Str("migration", m.String()).Msgf("migrated %s", cmd)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("migrate error")
+		return 1
+	}
+	if len(done) == 0 {
+		log.Info().Msg("nothing to migrate")
+	}
+	return 0
+}
+
+func migrateStatus(ctx context.Context, store *repository.PgStore, log zerolog.Logger) int {
+	status, err := store.MigrationStatus(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("migrate status error")
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range status {
+		applied := "pending"
+		if s.Applied() {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		name := s.Name
+		if s.Unknown {
+			name = "(unknown to this build)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, name, applied)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/receiver"
+
+	"github.com/rs/zerolog"
+)
+
+const replayUsage = `orderstorage replay [--since <time|seq>] [--until <time|seq>] [--idle 5s]
+
+Перечитывает историю тем из stan или JetStream (TRANSPORT) отдельной
+подпиской без durable и сохраняет заказы. Уже сохраненные заказы
+не меняются и считаются повторами.
+
+time — RFC 3339 (2024-01-02T15:04:05Z) или давность (36h),
+seq — номер сообщения в теме или потоке.
+`
+
+// replay — подкоманда orderstorage replay, возвращает код выхода.
+func replay(args []string, cfg config.Config, log zerolog.Logger) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), replayUsage)
+		fs.PrintDefaults()
+	}
+	since := fs.String("since", "", "начало истории: время или номер, пусто — с самого начала")
+	until := fs.String("until", "", "конец истории включительно: время или номер, пусто — до конца")
+	idle := fs.Duration("idle", 5*time.Second, "история кончилась, если столько нет новых сообщений")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	rng := receiver.ReplayRange{Idle: *idle}
+	var err error
+	if rng.SinceSeq, rng.SinceTime, err = parsePoint(*since); err != nil {
+		log.Error().Err(err).Msg("bad --since")
+		return 2
+	}
+	if rng.UntilSeq, rng.UntilTime, err = parsePoint(*until); err != nil {
+		log.Error().Err(err).Msg("bad --until")
+		return 2
+	}
+
+	// Сервис может работать одновременно: stan не пустит второго
+	// клиента с тем же id, файл и HTTP к истории отношения не имеют.
+	cfg.StanClientId += "-replay"
+	cfg.BackfillFile = ""
+	cfg.HttpPush = false
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	repo, err := newRepo(ctx, cfg, false, log)
+	if err != nil {
+		log.Error().Err(err).Msg("fail new repository")
+		return 1
+	}
+	defer repo.Close()
+
+	schemas, transform := newInspection(cfg, log)
+	rec, err := receiver.New(repo, schemas, transform, cfg, log)
+	if err != nil {
+		log.Error().Err(err).Msg("fail new receiver")
+		return 1
+	}
+	defer rec.Close()
+
+	start := time.Now()
+	st, err := rec.Replay(ctx, rng)
+	log.Info().
+		Uint64("read", st.Read).
+		Uint64("saved", st.Saved).
+		Uint64("duplicates", st.Duplicates).
+		Uint64("conflicts", st.Conflicts).
+		Uint64("rejected", st.Rejected).
+		Uint64("failed", st.Failed).
+		Dur("elapsed", time.Since(start)).
+		Msg("replay done")
+	if err != nil {
+		log.Error().Err(err).Msg("replay error")
+		return 1
+	}
+	if st.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parsePoint разбирает --since и --until: номер сообщения,
+// время RFC 3339 или давность от текущего момента.
+func parsePoint(s string) (uint64, time.Time, error) {
+	if s == "" {
+		return 0, time.Time{}, nil
+	}
+	if seq, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return seq, time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return 0, t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return 0, time.Now().Add(-d), nil
+	}
+	return 0, time.Time{}, fmt.Errorf("%q is neither a sequence, RFC 3339 time nor duration", s)
+}
@@ -122,7 +122,7 @@ func genOrder() repository.Order {
 			Currency:     fake.CurrencyShort(),
 			Provider:     "wbpay",
 			Amount:       3000,
-			PaymentDt:    0,
+			PaymentDt:    int(time.Now().Unix()),
 			Bank:         "SberBank",
 			DeliveryCost: 2403,
 			GoodsTotal:   597,
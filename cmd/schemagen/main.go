@@ -0,0 +1,22 @@
+// schemagen пересобирает файлы из internal/schema/order.json.
+// Запускается через go generate ./internal/schema.
+package main
+
+import (
+	"log"
+	"os"
+
+	"0lvl/internal/schema"
+)
+
+func main() {
+	for _, f := range schema.Files {
+		b, err := f.Generate(schema.Order)
+		if err != nil {
+			log.Fatalf("%s: %v", f.Path, err)
+		}
+		if err := os.WriteFile(f.Path, b, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package endpoint
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
+	"0lvl/internal/inspector"
+	"0lvl/internal/receiver"
 	"0lvl/internal/repository"
 
 	"github.com/julienschmidt/httprouter"
@@ -10,35 +16,124 @@ import (
 )
 
 var (
-	msgNoData = []byte(`{"message": "No data"}`)
+	msgNoData   = []byte(`{"message": "No data"}`)
+	msgBadParam = []byte(`{"message": "Bad parameter"}`)
+	msgResubmit = []byte(`{"message": "Resubmitted"}`)
+	msgNoSearch = []byte(`{"message": "Search requires NORMALIZE=true"}`)
 )
 
+const (
+	defaultRejectedLimit = 32
+	maxRejectedLimit     = 1024
+)
+
+// Receiver — то, что нужно эндпоинту от ресивера.
+type Receiver interface {
+	// Resubmit отправляет отвергнутый заказ повторно в его тему.
+	Resubmit(rec repository.RejectedOrder) error
+	// Stats возвращает текущие параметры накопителей.
+	Stats() []receiver.BatchStats
+	Topology() receiver.Topology
+	SetTopology(ctx context.Context, t receiver.Topology) error
+	// Противодавление: состояние, ручная пауза и ее снятие.
+	Backpressure() receiver.BackpressureStats
+	Pause()
+	Resume()
+}
+
 type Endpoint struct {
-	repo *repository.Repo
-	log  zerolog.Logger
+	repo      *repository.Repo
+	schemas   *inspector.Registry
+	transform *inspector.Transformer
+	receiver  Receiver
+	push      *receiver.HTTPSource
+	server    *http.Server
+	admin     *http.Server
+	log       zerolog.Logger
 }
 
-func New(repo *repository.Repo, log zerolog.Logger) *Endpoint {
-	return &Endpoint{
-		repo: repo,
-		log:  log,
+// push — прием заказов POST /order, /orders и /push/<тема>, nil — выключен.
+// adminAddr — адрес служебных маршрутов, меняющих работу ресивера,
+// см. adminRouter, пусто — они выключены.
+func New(repo *repository.Repo, schemas *inspector.Registry, transform *inspector.Transformer, rec Receiver, push *receiver.HTTPSource, adminAddr string, log zerolog.Logger) *Endpoint {
+	e := &Endpoint{
+		repo:      repo,
+		schemas:   schemas,
+		transform: transform,
+		receiver:  rec,
+		push:      push,
+		log:       log,
+	}
+	e.server = &http.Server{
+		Addr:    ":8000",
+		Handler: e.router(),
 	}
+	if adminAddr != "" {
+		e.admin = &http.Server{
+			Addr:    adminAddr,
+			Handler: e.adminRouter(),
+		}
+	}
+	return e
 }
 
 func (e *Endpoint) Run() {
+	if e.admin != nil {
+		go e.listen(e.admin)
+	}
+	e.listen(e.server)
+}
+
+func (e *Endpoint) listen(srv *http.Server) {
+	err := srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		e.log.Fatal().Err(err).Str("addr", srv.Addr).Msg("fail listen")
+	}
+}
+
+// Shutdown перестает принимать соединения
+// и ждет завершения текущих запросов, но не дольше ctx.
+func (e *Endpoint) Shutdown(ctx context.Context) error {
+	err := e.server.Shutdown(ctx)
+	if e.admin != nil {
+		err = errors.Join(err, e.admin.Shutdown(ctx))
+	}
+	return err
+}
+
+func (e *Endpoint) router() http.Handler {
 	router := httprouter.New()
 	router.GET("/", e.index)
 	router.GET("/order/:uid", e.order)
+	router.GET("/orders", e.searchOrders)
 	router.GET("/metric", e.metrica)
-
-	server := &http.Server{
-		Addr:    ":8000",
-		Handler: router,
-	}
-	err := server.ListenAndServe()
-	if err != nil {
-		e.log.Fatal().Err(err).Msg("fail listen")
+	router.GET("/metric/schema", e.schemaMetrica)
+	router.GET("/metric/receiver", e.receiverMetrica)
+	router.GET("/metric/backpressure", e.backpressure)
+	router.GET("/rejected", e.rejectedList)
+	router.GET("/rejected/:id", e.rejected)
+	router.GET("/receiver/topology", e.topology)
+	if e.push != nil {
+		router.POST("/order", e.pushOrder)
+		router.POST("/orders", e.pushOrders)
+		router.Handler("POST", "/push/*subject", http.StripPrefix("/push", e.push))
 	}
+	return router
+}
+
+// adminRouter — маршруты, которые меняют работу ресивера
+// и отправляют заказы от имени сервиса. Слушают отдельный адрес
+// config.AdminAddr, закрытый от клиентов.
+func (e *Endpoint) adminRouter() http.Handler {
+	router := httprouter.New()
+	router.GET("/metric/receiver", e.receiverMetrica)
+	router.GET("/metric/backpressure", e.backpressure)
+	router.POST("/rejected/:id/resubmit", e.resubmitRejected)
+	router.GET("/receiver/topology", e.topology)
+	router.PUT("/receiver/topology", e.setTopology)
+	router.POST("/receiver/pause", e.pause)
+	router.POST("/receiver/resume", e.resume)
+	return router
 }
 
 func (e *Endpoint) index(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -55,6 +150,14 @@ func (e *Endpoint) order(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		w.Write(msgNoData)
 		return
 	}
+
+	// Наружу заказ уходит только с замаскированными ПДн.
+	b, err = e.transform.Public(b)
+	if err != nil {
+		e.log.Err(err).Str("order uid", uid).Msg("public transform error")
+		w.WriteHeader(500)
+		return
+	}
 	w.Write(b)
 }
 
@@ -62,3 +165,172 @@ func (e *Endpoint) metrica(w http.ResponseWriter, r *http.Request, _ httprouter.
 	b := e.repo.Metrica()
 	w.Write(b)
 }
+
+// Сколько заказов принято и отвергнуто по каждой версии схемы.
+func (e *Endpoint) schemaMetrica(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b, _ := json.Marshal(e.schemas.Stats())
+	w.Write(b)
+}
+
+// Размер пакета и дедлайн каждого накопителя, задержка базы и входящий поток.
+func (e *Endpoint) receiverMetrica(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b, _ := json.Marshal(e.receiver.Stats())
+	w.Write(b)
+}
+
+// Отвергнутые и несохраненные заказы, от новых к старым, без payload.
+// Параметры: limit и before — id, с которого продолжить.
+func (e *Endpoint) rejectedList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	limit, before := defaultRejectedLimit, int64(0)
+	var err error
+
+	if s := q.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxRejectedLimit {
+			w.WriteHeader(400)
+			w.Write(msgBadParam)
+			return
+		}
+	}
+	if s := q.Get("before"); s != "" {
+		before, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || before < 0 {
+			w.WriteHeader(400)
+			w.Write(msgBadParam)
+			return
+		}
+	}
+
+	recs, err := e.repo.RejectedOrders(limit, before)
+	if err != nil {
+		e.log.Err(err).Msg("rejected orders error")
+		w.WriteHeader(500)
+		return
+	}
+	b, _ := json.Marshal(recs)
+	w.Write(b)
+}
+
+// RejectedView — отвергнутый заказ для отдачи наружу.
+// PayloadHidden — payload не разобрался по схеме и не отдается:
+// ПДн в нем не замаскировать.
+type RejectedView struct {
+	repository.RejectedOrder
+	PayloadHidden bool `json:"payload_hidden,omitempty"`
+}
+
+// Отвергнутый заказ вместе с payload, ПДн замаскированы как в /order/:uid.
+// Ключи, которых нет в схеме, не отдаются.
+func (e *Endpoint) rejected(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rec, ok := e.rejectedById(w, ps)
+	if !ok {
+		return
+	}
+
+	view := RejectedView{RejectedOrder: rec}
+	if len(rec.Payload) > 0 {
+		b, err := e.transform.Public(rec.Payload)
+		if err != nil {
+			view.Payload, view.PayloadHidden = nil, true
+		} else {
+			view.Payload = b
+		}
+	}
+	b, _ := json.Marshal(view)
+	w.Write(b)
+}
+
+// Отправляет отвергнутый заказ повторно в его тему.
+// Запись остается в rejected_order с отметкой resubmitted_at,
+// если заказ снова не пройдет, появится новая запись.
+func (e *Endpoint) resubmitRejected(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rec, ok := e.rejectedById(w, ps)
+	if !ok {
+		return
+	}
+
+	if err := e.receiver.Resubmit(rec); err != nil {
+		e.log.Err(err).Int64("rejected id", rec.Id).Msg("resubmit error")
+		w.WriteHeader(502)
+		return
+	}
+	if err := e.repo.MarkResubmitted(rec.Id); err != nil {
+		e.log.Err(err).Int64("rejected id", rec.Id).Msg("mark resubmitted error")
+	}
+	w.Write(msgResubmit)
+}
+
+// Пауза, задержка базы, ограничитель и глубина очередей к накопителям.
+func (e *Endpoint) backpressure(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b, _ := json.Marshal(e.receiver.Backpressure())
+	w.Write(b)
+}
+
+// Останавливает прием заказов до /receiver/resume.
+func (e *Endpoint) pause(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	e.receiver.Pause()
+	e.log.Info().Msg("receiver paused")
+	e.backpressure(w, r, nil)
+}
+
+func (e *Endpoint) resume(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	e.receiver.Resume()
+	e.log.Info().Msg("receiver resumed")
+	e.backpressure(w, r, nil)
+}
+
+func (e *Endpoint) topology(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	b, _ := json.Marshal(e.receiver.Topology())
+	w.Write(b)
+}
+
+// Меняет топологию ресивера на ходу.
+// Поля, которых нет в теле запроса, остаются прежними.
+func (e *Endpoint) setTopology(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	t := e.receiver.Topology()
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		w.WriteHeader(400)
+		w.Write(msgBadParam)
+		return
+	}
+
+	err := e.receiver.SetTopology(r.Context(), t)
+	switch {
+	case errors.Is(err, receiver.ErrBadTopology):
+		w.WriteHeader(400)
+		b, _ := json.Marshal(map[string]string{"message": err.Error()})
+		w.Write(b)
+		return
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// Новая топология уже действует, старые накопители еще сливают пакеты.
+		e.log.Warn().Err(err).Msg("receiver topology drain interrupted")
+	case err != nil:
+		e.log.Err(err).Msg("receiver topology error")
+		w.WriteHeader(503)
+		return
+	}
+	e.topology(w, r, nil)
+}
+
+func (e *Endpoint) rejectedById(w http.ResponseWriter, ps httprouter.Params) (repository.RejectedOrder, bool) {
+	id, err := strconv.ParseInt(ps.ByName("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write(msgBadParam)
+		return repository.RejectedOrder{}, false
+	}
+
+	rec, err := e.repo.RejectedOrder(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(404)
+		w.Write(msgNoData)
+		return rec, false
+	}
+	if err != nil {
+		e.log.Err(err).Int64("rejected id", id).Msg("rejected order error")
+		w.WriteHeader(500)
+		return rec, false
+	}
+	return rec, true
+}
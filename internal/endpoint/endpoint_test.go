@@ -0,0 +1,356 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+	"0lvl/internal/receiver"
+	"0lvl/internal/repository"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/rs/zerolog"
+)
+
+// newTestServer поднимает ресивер с HTTP источником и эндпоинт
+// над repository.MemStore: весь путь заказа без NATS и Postgres.
+// Второй сервер — служебные маршруты adminRouter.
+func newTestServer(t *testing.T) (*httptest.Server, *httptest.Server, *repository.Repo) {
+	t.Helper()
+
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BatchDeadline = 10 * time.Millisecond
+	cfg.BatchMinDeadline = time.Millisecond
+	// Копии одного заказа сохраняются в порядке строк.
+	cfg.OrderingKey = receiver.OrderByUid
+	log := zerolog.Nop()
+
+	repo, err := repository.New(repository.NewMemStore(), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := inspector.NewRegistry()
+	transform, err := inspector.NewTransformer(schemas, cfg.DropFields, cfg.MaskFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := receiver.New(repo, schemas, transform, cfg, log, receiver.NewHTTPSource(cfg.StanSubject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(repo, schemas, transform, rec, rec.HTTPSource(), cfg.AdminAddr, log)
+	srv := httptest.NewServer(e.router())
+	admin := httptest.NewServer(e.adminRouter())
+	t.Cleanup(func() {
+		srv.Close()
+		admin.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := rec.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+		repo.Close()
+	})
+	return srv, admin, repo
+}
+
+func testOrder(uid, customer string) string {
+	return datedOrder(uid, customer, "2021-11-26T06:22:19Z")
+}
+
+func datedOrder(uid, customer, date string) string {
+	var b bytes.Buffer
+	json.Compact(&b, []byte(fmt.Sprintf(orderTemplate, uid, customer, date)))
+	return b.String()
+}
+
+func do(t *testing.T, method, url, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, b
+}
+
+func TestEndpoint_PushAndRead(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	orders := strings.Join([]string{
+		testOrder("e2e0000000000000001", "alice"),
+		testOrder("e2e0000000000000002", "bob"),
+		testOrder("e2e0000000000000001", "alice"),
+		testOrder("e2e0000000000000001", "mallory"),
+		`{"order_uid": "e2e0000000000000003"}`,
+		`{"order_uid": "e2e0000000000000004", "delivery": {"phone": "+9720000000"}`,
+	}, "\n")
+	code, b := do(t, http.MethodPost, srv.URL+"/orders", orders)
+	if code != http.StatusOK {
+		t.Fatalf("POST /orders: %d %s", code, b)
+	}
+
+	var sum PushSummary
+	if err := json.Unmarshal(b, &sum); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		receiver.PushAccepted,
+		receiver.PushAccepted,
+		receiver.PushDuplicate,
+		receiver.PushRejected,
+		receiver.PushRejected,
+		receiver.PushRejected,
+	}
+	if len(sum.Results) != len(want) {
+		t.Fatalf("got %d results, want %d: %s", len(sum.Results), len(want), b)
+	}
+	for i, res := range sum.Results {
+		if res.Status != want[i] {
+			t.Errorf("line %d: status %s, want %s: %s", res.Line, res.Status, want[i], res.Error)
+		}
+	}
+
+	code, b = do(t, http.MethodGet, srv.URL+"/order/e2e0000000000000002", "")
+	if code != http.StatusOK || !bytes.Contains(b, []byte(`"bob"`)) {
+		t.Errorf("GET /order: %d %s", code, b)
+	}
+	code, _ = do(t, http.MethodGet, srv.URL+"/order/e2e0000000000000003", "")
+	if code != http.StatusNotFound {
+		t.Errorf("GET /order of rejected: %d, want 404", code)
+	}
+
+	var links []repository.OrderLink
+	_, b = do(t, http.MethodGet, srv.URL+"/", "")
+	if err := json.Unmarshal(b, &links); err != nil || len(links) != 2 {
+		t.Errorf("GET /: %s", b)
+	}
+
+	var m repository.Monitor
+	_, b = do(t, http.MethodGet, srv.URL+"/metric", "")
+	if err := json.Unmarshal(b, &m); err != nil || m.DatabaseOrderCount != 2 || m.DuplicateOrders != 1 || m.ConflictOrders != 1 {
+		t.Errorf("GET /metric: %s", b)
+	}
+
+	// Конфликт, заказ без полей и битый JSON лежат в rejected_order.
+	var recs []repository.RejectedOrder
+	_, b = do(t, http.MethodGet, srv.URL+"/rejected", "")
+	if err := json.Unmarshal(b, &recs); err != nil || len(recs) != 3 {
+		t.Fatalf("GET /rejected: %s", b)
+	}
+	for _, rec := range recs {
+		code, b = do(t, http.MethodGet, fmt.Sprintf("%s/rejected/%d", srv.URL, rec.Id), "")
+		var view RejectedView
+		if err := json.Unmarshal(b, &view); err != nil || code != http.StatusOK {
+			t.Fatalf("GET /rejected/:id: %d %s", code, b)
+		}
+		// ПДн маскируются, а то, что не разобрать, не отдается вовсе.
+		if bytes.Contains(view.Payload, []byte("+9720000000")) {
+			t.Errorf("GET /rejected/:id: pii in payload %s", view.Payload)
+		}
+		switch view.Uid {
+		case "e2e0000000000000001":
+			if !bytes.Contains(view.Payload, []byte(`"mallory"`)) || view.PayloadHidden {
+				t.Errorf("GET /rejected/:id of conflict: %s", b)
+			}
+		case "":
+			if view.Payload != nil || !view.PayloadHidden {
+				t.Errorf("GET /rejected/:id of broken json: %s", b)
+			}
+		}
+	}
+	code, _ = do(t, http.MethodGet, srv.URL+"/rejected/100", "")
+	if code != http.StatusNotFound {
+		t.Errorf("GET /rejected/100: %d, want 404", code)
+	}
+}
+
+func TestEndpoint_Search(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	orders := strings.Join([]string{
+		datedOrder("search00000000000001", "alice", "2021-11-25T12:00:00Z"),
+		datedOrder("search00000000000002", "alice", "2021-11-26T08:00:00Z"),
+		datedOrder("search00000000000003", "alice", "2021-11-27T00:00:00Z"),
+		datedOrder("search00000000000004", "bob", "2021-11-26T12:00:00Z"),
+	}, "\n")
+	// Даты в пределах PaymentSkew от payment_dt шаблона.
+	code, b := do(t, http.MethodPost, srv.URL+"/orders", orders)
+	var sum PushSummary
+	if err := json.Unmarshal(b, &sum); err != nil || code != http.StatusOK || sum.Accepted != 4 {
+		t.Fatalf("POST /orders: %d %s", code, b)
+	}
+
+	search := func(query string) ([]string, string) {
+		t.Helper()
+		code, b := do(t, http.MethodGet, srv.URL+"/orders?"+query, "")
+		if code != http.StatusOK {
+			t.Fatalf("GET /orders?%s: %d %s", query, code, b)
+		}
+		var res SearchResult
+		if err := json.Unmarshal(b, &res); err != nil {
+			t.Fatal(err)
+		}
+		var uids []string
+		for _, o := range res.Orders {
+			var order repository.Order
+			json.Unmarshal(o, &order)
+			uids = append(uids, order.OrderUid)
+		}
+		return uids, res.Next
+	}
+
+	// Вторая страница продолжает первую, от новых к старым.
+	uids, next := search("customer_id=alice&limit=2")
+	if fmt.Sprint(uids) != "[search00000000000003 search00000000000002]" || next == "" {
+		t.Errorf("page 1: %v %q", uids, next)
+	}
+	uids, next = search("customer_id=alice&limit=2&cursor=" + next)
+	if fmt.Sprint(uids) != "[search00000000000001]" || next != "" {
+		t.Errorf("page 2: %v %q", uids, next)
+	}
+
+	uids, _ = search("from=2021-11-26&to=2021-11-27")
+	if fmt.Sprint(uids) != "[search00000000000004 search00000000000002]" {
+		t.Errorf("date range: %v", uids)
+	}
+	uids, _ = search("chrt_id=9934930&phone=%2B9720000000&track_number=WBILMTESTTRACK&customer_id=bob")
+	if fmt.Sprint(uids) != "[search00000000000004]" {
+		t.Errorf("item and phone: %v", uids)
+	}
+
+	for _, query := range []string{"cursor=x", "from=yesterday", "limit=0", "chrt_id=a"} {
+		if code, _ := do(t, http.MethodGet, srv.URL+"/orders?"+query, ""); code != http.StatusBadRequest {
+			t.Errorf("GET /orders?%s: %d, want 400", query, code)
+		}
+	}
+}
+
+const orderTemplate = `{
+	"order_uid": %[1]q,
+	"track_number": "WBILMTESTTRACK",
+	"entry": "WBIL",
+	"delivery": {
+		"name": "Test Testov",
+		"phone": "+9720000000",
+		"zip": "2639809",
+		"city": "Kiryat Mozkin",
+		"address": "Ploshad Mira 15",
+		"region": "Kraiot",
+		"email": "test@gmail.com"
+	},
+	"payment": {
+		"transaction": %[1]q,
+		"request_id": "",
+		"currency": "USD",
+		"provider": "wbpay",
+		"amount": 1817,
+		"payment_dt": 1637907727,
+		"bank": "alpha",
+		"delivery_cost": 1500,
+		"goods_total": 317,
+		"custom_fee": 0
+	},
+	"items": [
+		{
+			"chrt_id": 9934930,
+			"track_number": "WBILMTESTTRACK",
+			"price": 453,
+			"rid": "ab4219087a764ae0btest",
+			"name": "Mascaras",
+			"sale": 30,
+			"size": "0",
+			"total_price": 317,
+			"nm_id": 2389212,
+			"brand": "Vivienne Sabo",
+			"status": 202
+		}
+	],
+	"locale": "en",
+	"internal_signature": "",
+	"customer_id": %[2]q,
+	"delivery_service": "meest",
+	"shardkey": "9",
+	"sm_id": 99,
+	"date_created": %[3]q,
+	"oof_shard": "1"
+}`
+
+func TestEndpoint_AdminRoutes(t *testing.T) {
+	srv, admin, _ := newTestServer(t)
+
+	routes := []struct{ method, path, body string }{
+		{http.MethodPut, "/receiver/topology", `{"subscribers": 1}`},
+		{http.MethodPost, "/receiver/pause", ""},
+		{http.MethodPost, "/receiver/resume", ""},
+		{http.MethodPost, "/rejected/1/resubmit", ""},
+	}
+	for _, r := range routes {
+		code, b := do(t, r.method, srv.URL+r.path, r.body)
+		if code != http.StatusNotFound && code != http.StatusMethodNotAllowed {
+			t.Errorf("public %s %s: %d %s", r.method, r.path, code, b)
+		}
+	}
+
+	code, b := do(t, http.MethodPost, admin.URL+"/receiver/pause", "")
+	if code != http.StatusOK {
+		t.Fatalf("admin POST /receiver/pause: %d %s", code, b)
+	}
+	_, b = do(t, http.MethodGet, srv.URL+"/metric/backpressure", "")
+	if !bytes.Contains(b, []byte(`"paused":true`)) {
+		t.Errorf("receiver is not paused: %s", b)
+	}
+	code, b = do(t, http.MethodPost, admin.URL+"/receiver/resume", "")
+	if code != http.StatusOK {
+		t.Errorf("admin POST /receiver/resume: %d %s", code, b)
+	}
+}
+
+// noSearchStore — Postgres без NORMALIZE.
+type noSearchStore struct {
+	*repository.MemStore
+}
+
+func (noSearchStore) Search(context.Context, repository.OrderQuery) (repository.OrderPage, error) {
+	return repository.OrderPage{}, repository.ErrSearchDisabled
+}
+
+func TestEndpoint_SearchDisabled(t *testing.T) {
+	repo, err := repository.New(noSearchStore{repository.NewMemStore()}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	srv := httptest.NewServer((&Endpoint{repo: repo, log: zerolog.Nop()}).router())
+	defer srv.Close()
+
+	code, b := do(t, http.MethodGet, srv.URL+"/orders?customer_id=alice", "")
+	if code != http.StatusNotImplemented || !bytes.Contains(b, []byte("NORMALIZE")) {
+		t.Errorf("GET /orders: %d %s", code, b)
+	}
+}
@@ -0,0 +1,101 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"0lvl/internal/receiver"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// Пределы POST /order и POST /orders.
+	maxOrderBytes  = 1024 * 1024
+	maxOrdersBytes = 16 * 1024 * 1024
+	maxOrdersLines = 10000
+)
+
+var msgTooLarge = []byte(`{"message": "Request too large"}`)
+
+// PushSummary — ответ POST /orders.
+type PushSummary struct {
+	Accepted  int                   `json:"accepted"`
+	Duplicate int                   `json:"duplicate"`
+	Rejected  int                   `json:"rejected"`
+	Retry     int                   `json:"retry"`
+	Results   []receiver.PushResult `json:"results"`
+}
+
+// Принимает один заказ в основную тему, JSON или формат из Content-Type.
+// Ответ ждет сохранения: 200, 422 с ошибками проверки или 503.
+func (e *Endpoint) pushOrder(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write(msgTooLarge)
+		return
+	}
+
+	res := e.push.Push(r.Context(), "", r.Header.Get("Content-Type"), body)
+	b, _ := json.Marshal(res)
+	w.WriteHeader(res.HTTPStatus())
+	w.Write(b)
+}
+
+// Принимает заказы NDJSON, по заказу на строку, пустые строки пропускаются.
+// Заказы сохраняются общими пакетами, ответ — итог каждой строки.
+func (e *Endpoint) pushOrders(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sc := bufio.NewScanner(http.MaxBytesReader(w, r.Body, maxOrdersBytes))
+	sc.Buffer(make([]byte, 0, 64*1024), maxOrderBytes)
+
+	var (
+		orders [][]byte
+		lines  []int
+	)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(orders) == maxOrdersLines {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write(msgTooLarge)
+			return
+		}
+		orders = append(orders, bytes.Clone(line))
+		lines = append(lines, n)
+	}
+	if err := sc.Err(); err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write(msgTooLarge)
+		return
+	}
+	if len(orders) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(msgNoData)
+		return
+	}
+
+	sum := PushSummary{Results: e.push.PushBatch(r.Context(), "", "", orders)}
+	for i := range sum.Results {
+		res := &sum.Results[i]
+		res.Line = lines[i]
+		switch res.Status {
+		case receiver.PushAccepted:
+			sum.Accepted++
+		case receiver.PushDuplicate:
+			sum.Duplicate++
+		case receiver.PushRejected:
+			sum.Rejected++
+		default:
+			sum.Retry++
+		}
+	}
+
+	b, _ := json.Marshal(sum)
+	w.Write(b)
+}
@@ -0,0 +1,118 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"0lvl/internal/repository"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultSearchLimit = 32
+	maxSearchLimit     = 1024
+)
+
+// SearchResult — страница GET /orders.
+// Next передается в cursor за следующей страницей, пустой — страниц больше нет.
+type SearchResult struct {
+	Orders []json.RawMessage `json:"orders"`
+	Next   string            `json:"next,omitempty"`
+}
+
+// Ищет заказы: GET /orders?customer_id=&track_number=&phone=&chrt_id=&from=&to=&limit=&cursor=
+// from и to — RFC 3339 или дата 2006-01-02, to не включается.
+// Заказы от новых к старым по date_created, с замаскированными ПДн.
+// Postgres без NORMALIZE не ищет: 501.
+func (e *Endpoint) searchOrders(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write(msgBadParam)
+		return
+	}
+
+	page, err := e.repo.Search(q)
+	if errors.Is(err, repository.ErrBadCursor) {
+		w.WriteHeader(400)
+		w.Write(msgBadParam)
+		return
+	}
+	if errors.Is(err, repository.ErrSearchDisabled) {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write(msgNoSearch)
+		return
+	}
+	if err != nil {
+		e.log.Err(err).Msg("search orders error")
+		w.WriteHeader(500)
+		return
+	}
+
+	res := SearchResult{
+		Orders: make([]json.RawMessage, 0, len(page.Orders)),
+		Next:   page.Next,
+	}
+	for _, o := range page.Orders {
+		b, err := e.transform.Public(o.Data)
+		if err != nil {
+			e.log.Err(err).Str("order uid", o.Uid).Msg("public transform error")
+			w.WriteHeader(500)
+			return
+		}
+		res.Orders = append(res.Orders, b)
+	}
+	b, _ := json.Marshal(res)
+	w.Write(b)
+}
+
+func parseOrderQuery(v url.Values) (repository.OrderQuery, error) {
+	q := repository.OrderQuery{
+		CustomerId:  v.Get("customer_id"),
+		TrackNumber: v.Get("track_number"),
+		Phone:       v.Get("phone"),
+		Limit:       defaultSearchLimit,
+		After:       v.Get("cursor"),
+	}
+	var err error
+
+	if s := v.Get("chrt_id"); s != "" {
+		q.ChrtId, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || q.ChrtId <= 0 {
+			return q, errBadParam
+		}
+	}
+	if q.From, err = parseDate(v.Get("from")); err != nil {
+		return q, err
+	}
+	if q.To, err = parseDate(v.Get("to")); err != nil {
+		return q, err
+	}
+	if s := v.Get("limit"); s != "" {
+		q.Limit, err = strconv.Atoi(s)
+		if err != nil || q.Limit <= 0 || q.Limit > maxSearchLimit {
+			return q, errBadParam
+		}
+	}
+	return q, nil
+}
+
+var errBadParam = errors.New("bad parameter")
+
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errBadParam
+}
@@ -26,6 +26,16 @@ import (
 
 //fastjson_custom                  101170	            11772 ns/op	      86.90 MB/s	   16768 B/op	      36 allocs/op
 
+//Тоже самое через Transformer.Canonical после jscan
+
+//jscan_custom + canonical         159729	             6777 ns/op	     150.95 MB/s	    1024 B/op	       1 allocs/op
+
+//Бинарные форматы переводятся в JSON и проверяются jscan, MB/s по размеру бинарного сообщения
+
+//msgpack to jscan                 147843	             7795 ns/op	     132.91 MB/s	    2304 B/op	       1 allocs/op
+//cbor to jscan                    167424	             6349 ns/op	     115.44 MB/s	    1536 B/op	       1 allocs/op
+//protobuf to jscan                 80545	            17012 ns/op	      19.40 MB/s	    1760 B/op	       5 allocs/op
+
 func BenchmarkJkjscan(b *testing.B) {
 	b.StopTimer()
 	sp := New()
@@ -56,6 +66,40 @@ func BenchmarkSample(b *testing.B) {
 	b.Run("gojsonschema", func(b *testing.B) {
 		benchmarkScheme(b)
 	})
+	b.Run("jscan custom + canonical", func(b *testing.B) {
+		benchmarkCanonical(b)
+	})
+	b.Run("msgpack to jscan", func(b *testing.B) {
+		benchmarkEncoding(b, EncodingMsgpack)
+	})
+	b.Run("cbor to jscan", func(b *testing.B) {
+		benchmarkEncoding(b, EncodingCBOR)
+	})
+	b.Run("protobuf to jscan", func(b *testing.B) {
+		benchmarkEncoding(b, EncodingProtobuf)
+	})
+}
+
+// Перевод бинарного заказа в JSON и проверка.
+// SetBytes по размеру бинарного сообщения.
+func benchmarkEncoding(b *testing.B, enc Encoding) {
+	b.StopTimer()
+	sp := New()
+	bb := encodeOrder(b, enc, data)
+	b.StartTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bb)))
+
+	for i := 0; i < b.N; i++ {
+		newBox := OrderBox{
+			Encoding: enc,
+			Data:     bb,
+		}
+		newBox = sp.Audit(newBox)
+		if newBox.Err != nil {
+			panic(fmt.Errorf("unexpected error: %s", newBox.Err))
+		}
+	}
 }
 
 func benchmarkJkjscan(b *testing.B) {
@@ -97,6 +141,32 @@ func benchmarkFastjson(b *testing.B) {
 	}
 }
 
+// Проверка и каноническое представление без сигнатуры,
+// как это делает подписчик.
+func benchmarkCanonical(b *testing.B) {
+	b.StopTimer()
+	sp := New()
+	tr, err := NewTransformer(sp.schemas, []string{Signature}, nil)
+	if err != nil {
+		panic(err)
+	}
+	bb := []byte(data)
+	b.StartTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		newBox := OrderBox{
+			Data: bb,
+		}
+		newBox = sp.Audit(newBox)
+		newBox = tr.Canonical(newBox)
+		if newBox.Err != nil {
+			panic(fmt.Errorf("unexpected error: %s", newBox.Err))
+		}
+	}
+}
+
 func benchmarkScheme(b *testing.B) {
 	b.StopTimer()
 	schemaLoader := gojsonschema.NewStringLoader(sheme)
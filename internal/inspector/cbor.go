@@ -0,0 +1,242 @@
+package inspector
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// Старшие три бита начального байта CBOR.
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+
+	// Неопределенная длина массива или map, конец по break.
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// decodeCBOR переводит CBOR (RFC 8949) в JSON.
+// Теги пропускаются, байтовые строки и строки
+// неопределенной длины не поддерживаются.
+func decodeCBOR(dst, src []byte) ([]byte, error) {
+	d := cborDecoder{src: src}
+	dst, err := d.value(dst, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(src) {
+		return nil, syntaxError(d.pos)
+	}
+	return dst, nil
+}
+
+type cborDecoder struct {
+	src []byte
+	pos int
+}
+
+// head читает начальный байт и аргумент.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	if d.pos >= len(d.src) {
+		return 0, 0, 0, syntaxError(d.pos)
+	}
+	c := d.src[d.pos]
+	d.pos++
+	major, info = c>>5, c&0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, syntaxError(d.pos - 1)
+	}
+
+	if len(d.src)-d.pos < size {
+		return 0, 0, 0, syntaxError(d.pos)
+	}
+	b := d.src[d.pos : d.pos+size]
+	d.pos += size
+
+	switch size {
+	case 1:
+		arg = uint64(b[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(b))
+	default:
+		arg = binary.BigEndian.Uint64(b)
+	}
+	return major, info, arg, nil
+}
+
+func (d *cborDecoder) value(dst []byte, depth int) ([]byte, error) {
+	if depth >= maxDepth {
+		return nil, syntaxError(d.pos)
+	}
+
+	start := d.pos
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if info == cborIndefinite {
+			return nil, syntaxError(start)
+		}
+		return strconv.AppendUint(dst, arg, 10), nil
+
+	case cborNegint:
+		if info == cborIndefinite || arg > math.MaxInt64 {
+			return nil, syntaxError(start)
+		}
+		return strconv.AppendInt(dst, -1-int64(arg), 10), nil
+
+	case cborText:
+		if info == cborIndefinite || arg > uint64(len(d.src)-d.pos) {
+			return nil, syntaxError(start)
+		}
+		b := d.src[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		return appendString(dst, unsafeB2S(b)), nil
+
+	case cborArray:
+		return d.array(dst, info == cborIndefinite, arg, depth)
+
+	case cborMap:
+		return d.object(dst, info == cborIndefinite, arg, depth)
+
+	case cborTag:
+		if info == cborIndefinite {
+			return nil, syntaxError(start)
+		}
+		return d.value(dst, depth+1)
+
+	case cborSimple:
+		switch info {
+		case 20:
+			return append(dst, "false"...), nil
+		case 21:
+			return append(dst, "true"...), nil
+		case 22:
+			return append(dst, "null"...), nil
+		case 25:
+			return appendFloat(dst, halfFloat(uint16(arg)), start)
+		case 26:
+			return appendFloat(dst, float64(math.Float32frombits(uint32(arg))), start)
+		case 27:
+			return appendFloat(dst, math.Float64frombits(arg), start)
+		}
+	}
+
+	// Байтовые строки, undefined и прочие simple в JSON не переводятся.
+	return nil, syntaxError(start)
+}
+
+// next сообщает, есть ли еще элемент у массива или map.
+// Для неопределенной длины съедает break.
+func (d *cborDecoder) next(indefinite bool, i, n uint64) (bool, error) {
+	if !indefinite {
+		return i < n, nil
+	}
+	if d.pos >= len(d.src) {
+		return false, syntaxError(d.pos)
+	}
+	if d.src[d.pos] == cborBreak {
+		d.pos++
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *cborDecoder) array(dst []byte, indefinite bool, n uint64, depth int) ([]byte, error) {
+	dst = append(dst, '[')
+	for i := uint64(0); ; i++ {
+		ok, err := d.next(indefinite, i, n)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst, err = d.value(dst, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (d *cborDecoder) object(dst []byte, indefinite bool, n uint64, depth int) ([]byte, error) {
+	dst = append(dst, '{')
+	for i := uint64(0); ; i++ {
+		ok, err := d.next(indefinite, i, n)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+
+		// Ключ обязан быть текстовой строкой.
+		if d.pos >= len(d.src) || d.src[d.pos]>>5 != cborText {
+			return nil, syntaxError(d.pos)
+		}
+		dst, err = d.value(dst, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		dst = append(dst, ':')
+
+		dst, err = d.value(dst, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// halfFloat переводит IEEE 754 half precision в float64.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
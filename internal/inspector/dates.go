@@ -0,0 +1,73 @@
+package inspector
+
+import (
+	"strconv"
+	"time"
+)
+
+// DateWindow — допустимые границы дат в заказе.
+// Даты не позже начала эпохи Unix отвергаются всегда.
+type DateWindow struct {
+	// Насколько дата может опережать часы сервиса, 0 — без ограничения.
+	MaxFuture time.Duration
+	// Насколько дата может быть в прошлом, 0 — без ограничения.
+	MaxAge time.Duration
+	// Допустимое расхождение payment.payment_dt и date_created,
+	// 0 — не сверять.
+	PaymentSkew time.Duration
+}
+
+var defaultDateWindow = DateWindow{
+	MaxFuture:   5 * time.Minute,
+	PaymentSkew: 24 * time.Hour,
+}
+
+// WithDateWindow задает границы дат вместо defaultDateWindow.
+func WithDateWindow(w DateWindow) Option {
+	return func(sp *Ispector) {
+		sp.dates = w
+	}
+}
+
+var epoch = time.Unix(0, 0)
+
+// parseFormat разбирает значение с форматом схемы,
+// val — значение как есть в JSON, строки в кавычках.
+func parseFormat(format string, val string) (time.Time, bool) {
+	switch format {
+	case FormatDateTime:
+		t, err := time.Parse(time.RFC3339, val[1:len(val)-1])
+		return t, err == nil
+	case FormatUnixTime:
+		sec, err := strconv.ParseInt(val, 10, 64)
+		return time.Unix(sec, 0), err == nil
+	}
+	return time.Time{}, true
+}
+
+// check возвращает нарушенную границу или "".
+func (w DateWindow) check(t, now time.Time) string {
+	if !t.After(epoch) {
+		return "> " + epoch.UTC().Format(time.RFC3339)
+	}
+	if w.MaxFuture > 0 {
+		if limit := now.Add(w.MaxFuture); t.After(limit) {
+			return "<= " + limit.UTC().Format(time.RFC3339)
+		}
+	}
+	if w.MaxAge > 0 {
+		if limit := now.Add(-w.MaxAge); t.Before(limit) {
+			return ">= " + limit.UTC().Format(time.RFC3339)
+		}
+	}
+	return ""
+}
+
+// consistent сверяет время оплаты со временем создания заказа.
+func (w DateWindow) consistent(created, paid time.Time) bool {
+	if w.PaymentSkew <= 0 {
+		return true
+	}
+	d := paid.Sub(created)
+	return d <= w.PaymentSkew && d >= -w.PaymentSkew
+}
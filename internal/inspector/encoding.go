@@ -0,0 +1,117 @@
+package inspector
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Encoding — формат, в котором паблишер прислал заказ.
+// Любой формат перед проверкой переводится в JSON,
+// поэтому схема и хранимое представление у всех общие.
+type Encoding uint8
+
+const (
+	EncodingJSON Encoding = iota
+	EncodingMsgpack
+	EncodingCBOR
+	EncodingProtobuf
+)
+
+var encodingNames = [...]string{
+	EncodingJSON:     "json",
+	EncodingMsgpack:  "msgpack",
+	EncodingCBOR:     "cbor",
+	EncodingProtobuf: "protobuf",
+}
+
+func (e Encoding) String() string {
+	if int(e) < len(encodingNames) {
+		return encodingNames[e]
+	}
+	return "encoding(" + strconv.Itoa(int(e)) + ")"
+}
+
+// ParseEncoding понимает короткое имя (суффикс темы)
+// и MIME тип из заголовка Content-Type сообщения JetStream
+// или запроса HTTP, см. receiver.route.encodingOf.
+func ParseEncoding(s string) (Encoding, bool) {
+	s, _, _ = strings.Cut(s, ";")
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "json", "application/json":
+		return EncodingJSON, true
+	case "msgpack", "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return EncodingMsgpack, true
+	case "cbor", "application/cbor":
+		return EncodingCBOR, true
+	case "protobuf", "proto", "application/protobuf", "application/x-protobuf":
+		return EncodingProtobuf, true
+	}
+	return 0, false
+}
+
+// decode переводит бинарный заказ в JSON.
+// Ошибки схемы после перевода ищет Audit,
+// их смещения относятся уже к JSON.
+func (sp Ispector) decode(box OrderBox) OrderBox {
+	if box.Encoding == EncodingJSON {
+		return box
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	dst := make([]byte, 0, len(box.Data)*2)
+
+	switch box.Encoding {
+	case EncodingMsgpack:
+		data, err = decodeMsgpack(dst, box.Data)
+	case EncodingCBOR:
+		data, err = decodeCBOR(dst, box.Data)
+	case EncodingProtobuf:
+		// Номера полей зависят от версии схемы,
+		// поэтому версию нужно знать до разбора.
+		if box.Version == "" {
+			box.Version = protobufVersion(box.Data)
+		}
+		ver, ok := sp.schemas.lookup(box.Version)
+		if !ok {
+			box.Err = &ValidationError{
+				Code:    CodeUnknownVersion,
+				Pointer: "/" + versionKey,
+				Actual:  box.Version,
+			}
+			return box
+		}
+		data, err = decodeProtobuf(dst, box.Data, ver.schema)
+	default:
+		err = &ValidationError{
+			Code:   CodeSyntax,
+			Actual: box.Encoding.String(),
+		}
+	}
+
+	if err != nil {
+		box.Err = err
+		return box
+	}
+	box.Data = data
+	box.Encoding = EncodingJSON
+	return box
+}
+
+func syntaxError(offset int) *ValidationError {
+	return &ValidationError{
+		Code:   CodeSyntax,
+		Offset: offset,
+	}
+}
+
+// appendFloat пишет число так, как его понимает JSON.
+func appendFloat(dst []byte, f float64, pos int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, syntaxError(pos)
+	}
+	return strconv.AppendFloat(dst, f, 'g', -1, 64), nil
+}
@@ -0,0 +1,301 @@
+package inspector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"0lvl/internal/schema"
+
+	"github.com/romshark/jscan/v2"
+)
+
+func TestIspector_AuditEncodings(t *testing.T) {
+	ins := New()
+	tr, err := NewTransformer(ins.schemas, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := tr.Canonical(ins.Audit(OrderBox{Data: []byte(ord_valid)}))
+	if want.Err != nil {
+		t.Fatal(want.Err)
+	}
+
+	for _, enc := range []Encoding{EncodingMsgpack, EncodingCBOR, EncodingProtobuf} {
+		t.Run(enc.String(), func(t *testing.T) {
+			data := encodeOrder(t, enc, ord_valid)
+
+			newBox := ins.Audit(OrderBox{Encoding: enc, Data: data})
+			if newBox.Err != nil {
+				t.Fatal(newBox.Err)
+			}
+			if newBox.Uid != "b563feb7b2b84b6test" || newBox.Rang != want.Rang {
+				t.Errorf("got uid %q rang %d", newBox.Uid, newBox.Rang)
+			}
+
+			newBox = tr.Canonical(newBox)
+			if !bytes.Equal(newBox.Data, want.Data) {
+				t.Errorf("canonical differs:\n%s\n%s", newBox.Data, want.Data)
+			}
+
+			newBox = ins.Audit(OrderBox{Encoding: enc, Data: data[:len(data)-1]})
+			if errs := Errors(newBox.Err); len(errs) == 0 {
+				t.Errorf("truncated %s accepted", enc)
+			}
+		})
+	}
+}
+
+func TestIspector_AuditEncodingErrors(t *testing.T) {
+	ins := New()
+	tests := []struct {
+		name    string
+		enc     Encoding
+		data    string
+		code    ErrorCode
+		pointer string
+	}{
+		{"msgpack_type", EncodingMsgpack, strings.Replace(ord_valid, `"price": 453`, `"price": "453"`, 1), CodeTypeMismatch, "/items/0/price"},
+		{"cbor_unknown", EncodingCBOR, strings.Replace(ord_valid, `"zip"`, `"zap"`, 1), CodeUnknownKey, "/delivery/zap"},
+		{"protobuf_empty_items", EncodingProtobuf, ord_not_items, CodeEmptyArray, "/items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newBox := ins.Audit(OrderBox{Encoding: tt.enc, Data: encodeOrder(t, tt.enc, tt.data)})
+			var verr *ValidationError
+			if !errors.As(newBox.Err, &verr) {
+				t.Fatalf("expected *ValidationError, got %v", newBox.Err)
+			}
+			if verr.Code != tt.code || verr.Pointer != tt.pointer {
+				t.Errorf("got %s %q, want %s %q", verr.Code, verr.Pointer, tt.code, tt.pointer)
+			}
+		})
+	}
+
+	// Строка на месте числа в protobuf ловится еще при разборе.
+	data := appendProtoTag(nil, 12, wireBytes)
+	data = appendProtoBytes(data, []byte("99"))
+	newBox := ins.Audit(OrderBox{Encoding: EncodingProtobuf, Data: data})
+	if errs := Errors(newBox.Err); len(errs) != 1 || errs[0].Code != CodeTypeMismatch || errs[0].Pointer != "/sm_id" {
+		t.Errorf("unexpected error: %v", newBox.Err)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	tests := map[string]Encoding{
+		"":                                EncodingJSON,
+		"application/json; charset=utf-8": EncodingJSON,
+		"msgpack":                         EncodingMsgpack,
+		"application/x-msgpack":           EncodingMsgpack,
+		"application/cbor":                EncodingCBOR,
+		"application/x-protobuf":          EncodingProtobuf,
+	}
+	for s, want := range tests {
+		if got, ok := ParseEncoding(s); !ok || got != want {
+			t.Errorf("ParseEncoding(%q) = %s, %v", s, got, ok)
+		}
+	}
+	if _, ok := ParseEncoding("text/xml"); ok {
+		t.Error("text/xml must not be accepted")
+	}
+}
+
+// Номера полей protobuf берутся из описания, а не из порядка ключей.
+func TestDecodeProtobuf_StableNumbers(t *testing.T) {
+	b, err := json.Marshal(schema.Order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := schema.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := def.Lookup(def.Root)
+	for i, j := 0, len(root.Fields)-1; i < j; i, j = i+1, j-1 {
+		root.Fields[i], root.Fields[j] = root.Fields[j], root.Fields[i]
+	}
+
+	data := encodeOrder(t, EncodingProtobuf, ord_valid)
+	var orders [2]map[string]any
+	for i, scheme := range []*node{createScheme(), schemeOf(def, def.Root)} {
+		out, err := decodeProtobuf(nil, data, scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(out, &orders[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(orders[0], orders[1]) {
+		t.Errorf("decoded orders differ:\n%v\n%v", orders[0], orders[1])
+	}
+}
+
+// encodeOrder перекодирует JSON заказ в бинарный формат.
+func encodeOrder(tb testing.TB, enc Encoding, data string) []byte {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		tb.Fatal(err)
+	}
+
+	switch enc {
+	case EncodingMsgpack:
+		return appendMsgpack(nil, v)
+	case EncodingCBOR:
+		return appendCBOR(nil, v)
+	case EncodingProtobuf:
+		return appendProtobuf(nil, v.(map[string]any), createScheme())
+	}
+	return []byte(data)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendMsgpack(dst []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, 0xc0)
+	case bool:
+		if v {
+			return append(dst, 0xc3)
+		}
+		return append(dst, 0xc2)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			dst = append(dst, 0xd3)
+			return binary.BigEndian.AppendUint64(dst, uint64(n))
+		}
+		f, _ := v.Float64()
+		dst = append(dst, 0xcb)
+		return binary.BigEndian.AppendUint64(dst, math.Float64bits(f))
+	case string:
+		dst = append(dst, 0xdb)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(v)))
+		return append(dst, v...)
+	case []any:
+		dst = append(dst, 0xdd)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(v)))
+		for _, el := range v {
+			dst = appendMsgpack(dst, el)
+		}
+		return dst
+	case map[string]any:
+		dst = append(dst, 0xdf)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(v)))
+		for _, k := range sortedKeys(v) {
+			dst = appendMsgpack(dst, k)
+			dst = appendMsgpack(dst, v[k])
+		}
+		return dst
+	}
+	panic("unsupported value")
+}
+
+func appendCBORHead(dst []byte, major byte, n uint64) []byte {
+	if n < 24 {
+		return append(dst, major<<5|byte(n))
+	}
+	dst = append(dst, major<<5|27)
+	return binary.BigEndian.AppendUint64(dst, n)
+}
+
+func appendCBOR(dst []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, 0xf6)
+	case bool:
+		if v {
+			return append(dst, 0xf5)
+		}
+		return append(dst, 0xf4)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n < 0 {
+				return appendCBORHead(dst, cborNegint, uint64(-1-n))
+			}
+			return appendCBORHead(dst, cborUint, uint64(n))
+		}
+		f, _ := v.Float64()
+		dst = append(dst, 0xfb)
+		return binary.BigEndian.AppendUint64(dst, math.Float64bits(f))
+	case string:
+		dst = appendCBORHead(dst, cborText, uint64(len(v)))
+		return append(dst, v...)
+	case []any:
+		// Массивы неопределенной длины, чтобы проверить и break.
+		dst = append(dst, cborArray<<5|cborIndefinite)
+		for _, el := range v {
+			dst = appendCBOR(dst, el)
+		}
+		return append(dst, cborBreak)
+	case map[string]any:
+		dst = appendCBORHead(dst, cborMap, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			dst = appendCBOR(dst, k)
+			dst = appendCBOR(dst, v[k])
+		}
+		return dst
+	}
+	panic("unsupported value")
+}
+
+func appendProtoTag(dst []byte, num int, wire byte) []byte {
+	return binary.AppendUvarint(dst, uint64(num)<<3|uint64(wire))
+}
+
+func appendProtoBytes(dst []byte, b []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// appendProtobuf кодирует объект по схеме, как proto3 опуская нулевые значения.
+func appendProtobuf(dst []byte, m map[string]any, schema *node) []byte {
+	for _, f := range schema.Fields {
+		v, ok := m[f.Name]
+		if !ok {
+			continue
+		}
+		num := int(f.Num)
+
+		switch f.Value.Type {
+		case jscan.ValueTypeNumber:
+			n, _ := v.(json.Number).Int64()
+			if n == 0 {
+				continue
+			}
+			dst = appendProtoTag(dst, num, wireVarint)
+			dst = binary.AppendUvarint(dst, uint64(n))
+		case jscan.ValueTypeString:
+			if v == "" {
+				continue
+			}
+			dst = appendProtoTag(dst, num, wireBytes)
+			dst = appendProtoBytes(dst, []byte(v.(string)))
+		case jscan.ValueTypeObject:
+			dst = appendProtoTag(dst, num, wireBytes)
+			dst = appendProtoBytes(dst, appendProtobuf(nil, v.(map[string]any), f.Value))
+		case jscan.ValueTypeArray:
+			for _, el := range v.([]any) {
+				dst = appendProtoTag(dst, num, wireBytes)
+				dst = appendProtoBytes(dst, appendProtobuf(nil, el.(map[string]any), f.Value.Elem))
+			}
+		}
+	}
+	return dst
+}
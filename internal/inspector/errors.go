@@ -0,0 +1,107 @@
+package inspector
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrorCode — машиночитаемая причина отказа,
+// ее можно вернуть паблишеру как есть.
+type ErrorCode string
+
+const (
+	CodeTooLarge       ErrorCode = "too_large"
+	CodeTooManyItems   ErrorCode = "too_many_items"
+	CodeUnknownVersion ErrorCode = "unknown_version"
+	CodeSyntax         ErrorCode = "syntax"
+	CodeUnknownKey     ErrorCode = "unknown_key"
+	CodeDuplicateKey   ErrorCode = "duplicate_key"
+	CodeMissingKey     ErrorCode = "missing_key"
+	CodeTypeMismatch   ErrorCode = "type_mismatch"
+	CodeEmptyArray     ErrorCode = "empty_array"
+	CodeInvalidValue   ErrorCode = "invalid_value"
+	CodeOutOfRange     ErrorCode = "out_of_range"
+	CodeInconsistent   ErrorCode = "inconsistent"
+)
+
+// errorCodes — все коды, по ним ведутся счетчики отказов.
+var errorCodes = [...]ErrorCode{
+	CodeTooLarge,
+	CodeTooManyItems,
+	CodeUnknownVersion,
+	CodeSyntax,
+	CodeUnknownKey,
+	CodeDuplicateKey,
+	CodeMissingKey,
+	CodeTypeMismatch,
+	CodeEmptyArray,
+	CodeInvalidValue,
+	CodeOutOfRange,
+	CodeInconsistent,
+}
+
+var errorCodeIndex = func() map[ErrorCode]int {
+	m := make(map[ErrorCode]int, len(errorCodes))
+	for i, code := range errorCodes {
+		m[code] = i
+	}
+	return m
+}()
+
+// ValidationError описывает одну проблему в заказе.
+// Pointer — JSON pointer (RFC 6901) на проблемное значение,
+// Offset — смещение в байтах от начала сообщения.
+type ValidationError struct {
+	Code     ErrorCode `json:"code"`
+	Pointer  string    `json:"pointer"`
+	Expected string    `json:"expected,omitempty"`
+	Actual   string    `json:"actual,omitempty"`
+	Offset   int       `json:"offset"`
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(string(e.Code))
+	if e.Pointer != "" {
+		sb.WriteString(" at ")
+		sb.WriteString(e.Pointer)
+	}
+	if e.Expected != "" || e.Actual != "" {
+		sb.WriteString(": expected ")
+		sb.WriteString(e.Expected)
+		sb.WriteString(", got ")
+		sb.WriteString(e.Actual)
+	}
+	sb.WriteString(" (offset ")
+	sb.WriteString(strconv.Itoa(e.Offset))
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// ValidationErrors — все найденные проблемы в режиме CollectAll.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	if len(es) == 0 {
+		return ""
+	}
+	if len(es) == 1 {
+		return es[0].Error()
+	}
+	return es[0].Error() + " (and " + strconv.Itoa(len(es)-1) + " more)"
+}
+
+// Errors разворачивает ошибку Audit в список.
+// Для ошибок не от инспектора возвращает nil.
+func Errors(err error) []*ValidationError {
+	var es ValidationErrors
+	if errors.As(err, &es) {
+		return es
+	}
+	var e *ValidationError
+	if errors.As(err, &e) {
+		return []*ValidationError{e}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package inspector
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"0lvl/internal/schema"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Эти проверки есть только у инспектора, эталон о них не знает.
+var auditOnlyCodes = map[ErrorCode]bool{
+	CodeTooLarge:     true,
+	CodeTooManyItems: true,
+	CodeDuplicateKey: true,
+	CodeInvalidValue: true,
+	CodeOutOfRange:   true,
+	CodeInconsistent: true,
+}
+
+func newFuzzIspector() Ispector {
+	return New(WithDateWindow(DateWindow{MaxFuture: 100 * 365 * 24 * time.Hour}))
+}
+
+// referenceLoader возвращает JSON Schema, сгенерированную
+// из того же описания, что и схема инспектора.
+func referenceLoader(tb testing.TB) gojsonschema.JSONLoader {
+	b, err := schema.JSONSchema(schema.Order)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return gojsonschema.NewBytesLoader(b)
+}
+
+func fuzzSeeds(f *testing.F) {
+	for _, seed := range []string{ord_valid, ord_not_items, ord_not_key, data, "{}", "[]", `{"items":[{}]}`, `"`, ""} {
+		f.Add([]byte(seed))
+	}
+}
+
+func FuzzIspector_Audit(f *testing.F) {
+	fuzzSeeds(f)
+	ins := newFuzzIspector()
+	tr, err := NewTransformer(ins.schemas, nil, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		src := string(b)
+		newBox := ins.Audit(OrderBox{Data: b})
+		if string(b) != src {
+			t.Fatal("audit modified input")
+		}
+
+		if newBox.Err != nil {
+			if len(Errors(newBox.Err)) == 0 {
+				t.Fatalf("audit error is not a ValidationError: %v", newBox.Err)
+			}
+			return
+		}
+
+		if !json.Valid(b) {
+			t.Fatalf("invalid json accepted: %q", b)
+		}
+
+		// Каноническое представление само проходит проверку
+		// и не меняется при повторном приведении.
+		c := tr.Canonical(newBox)
+		if c.Err != nil {
+			t.Fatalf("canonical of accepted order: %v", c.Err)
+		}
+		again := ins.Audit(OrderBox{Data: c.Data})
+		if again.Err != nil || again.Uid != newBox.Uid || again.Rang != newBox.Rang {
+			t.Fatalf("canonical %s: %v", c.Data, again.Err)
+		}
+		if cc := tr.Canonical(again); string(cc.Data) != string(c.Data) {
+			t.Fatalf("canonical is not stable:\n%s\n%s", c.Data, cc.Data)
+		}
+	})
+}
+
+func FuzzIspector_Decode(f *testing.F) {
+	for _, enc := range []Encoding{EncodingMsgpack, EncodingCBOR, EncodingProtobuf} {
+		f.Add(uint8(enc), encodeOrder(f, enc, ord_valid))
+	}
+	ins := newFuzzIspector()
+
+	f.Fuzz(func(t *testing.T, enc uint8, b []byte) {
+		newBox := ins.decode(OrderBox{Encoding: Encoding(enc%3 + 1), Data: b})
+		if newBox.Err == nil && !json.Valid(newBox.Data) {
+			t.Fatalf("decoded to invalid json: %q", newBox.Data)
+		}
+	})
+}
+
+func FuzzIspector_Differential(f *testing.F) {
+	fuzzSeeds(f)
+	ins := newFuzzIspector()
+	ref := referenceLoader(f)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		compareWithReference(t, ins, ref, b)
+	})
+}
+
+// TestIspector_Differential сверяет вердикты на заказах
+// с удаленным, переименованным или другого типа ключом.
+func TestIspector_Differential(t *testing.T) {
+	ins := newFuzzIspector()
+	ref := referenceLoader(t)
+
+	var order map[string]any
+	if err := json.Unmarshal([]byte(ord_valid), &order); err != nil {
+		t.Fatal(err)
+	}
+
+	replacements := []any{"s", 1.5, 7, nil, true, map[string]any{}, []any{}, []any{map[string]any{}}}
+	count := 0
+
+	var walk func(obj map[string]any)
+	walk = func(obj map[string]any) {
+		for key, val := range obj {
+			obj[key+"_x"] = val
+			delete(obj, key)
+			compareOrder(t, ins, ref, order)
+
+			delete(obj, key+"_x")
+			compareOrder(t, ins, ref, order)
+
+			for _, r := range replacements {
+				obj[key] = r
+				compareOrder(t, ins, ref, order)
+			}
+			obj[key] = val
+			count += 2 + len(replacements)
+
+			switch v := val.(type) {
+			case map[string]any:
+				walk(v)
+			case []any:
+				for _, el := range v {
+					walk(el.(map[string]any))
+				}
+			}
+		}
+	}
+	walk(order)
+	compareOrder(t, ins, ref, order)
+
+	if count < 300 {
+		t.Errorf("only %d mutations checked", count)
+	}
+}
+
+func compareOrder(t *testing.T, ins Ispector, ref gojsonschema.JSONLoader, order map[string]any) {
+	t.Helper()
+	b, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareWithReference(t, ins, ref, b)
+}
+
+func compareWithReference(t *testing.T, ins Ispector, ref gojsonschema.JSONLoader, b []byte) {
+	t.Helper()
+	if !json.Valid(b) {
+		return
+	}
+
+	res, err := gojsonschema.Validate(ref, gojsonschema.NewBytesLoader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newBox := ins.Audit(OrderBox{Data: b})
+	if errs := Errors(newBox.Err); len(errs) > 0 && auditOnlyCodes[errs[0].Code] {
+		return
+	}
+
+	if res.Valid() != (newBox.Err == nil) {
+		var reasons []string
+		for _, e := range res.Errors() {
+			reasons = append(reasons, e.String())
+		}
+		t.Fatalf("verdicts differ on %s\ninspector: %v\nreference: %s", b, newBox.Err, strings.Join(reasons, "; "))
+	}
+}
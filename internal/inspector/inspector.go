@@ -2,93 +2,447 @@ package inspector
 
 import (
 	"errors"
-	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/nats-io/stan.go"
 	"github.com/romshark/jscan/v2"
 )
 
 const (
+	// Предел размера заказа по умолчанию, см. Limits.
 	maxLenData = 1024 * 3
+
+	// Глубже схема заказа не бывает,
+	// все что глубже отсекается как неизвестный ключ.
+	maxDepth = 8
 )
 
 type OrderBox struct {
-	Uid  string
-	Rang int64
-	Msg  *stan.Msg
-	Data []byte
-	Err  error
+	Uid      string
+	Rang     int64
+	Version  string
+	Encoding Encoding
+	Msg      Message
+	Data     []byte
+	Err      error
+
+	// Значение поля WithPartitionKey, если оно задано.
+	Key string
 }
 
 type Ispector struct {
-	parser *jscan.Parser[string]
-	schema map[string]value
+	parser  *jscan.Parser[string]
+	schemas *Registry
+	dates   DateWindow
+	now     func() time.Time
+
+	// Строковое поле первого уровня, которое попадет в box.Key.
+	partitionKey string
+
+	collectAll bool
+}
+
+type Option func(*Ispector)
+
+// CollectAll не останавливает проверку на первой ошибке,
+// в box.Err окажется ValidationErrors со всеми найденными.
+func CollectAll() Option {
+	return func(sp *Ispector) {
+		sp.collectAll = true
+	}
+}
+
+// WithRegistry задает общий реестр версий схемы,
+// чтобы счетчики по версиям собирались со всех подписчиков.
+func WithRegistry(r *Registry) Option {
+	return func(sp *Ispector) {
+		sp.schemas = r
+	}
+}
+
+// WithPartitionKey сохраняет в box.Key значение строкового поля
+// первого уровня, например customer_id, без лишних аллокаций.
+func WithPartitionKey(key string) Option {
+	return func(sp *Ispector) {
+		sp.partitionKey = key
+	}
 }
 
-func New() Ispector {
-	return Ispector{
-		parser: jscan.NewParser[string](64),
-		schema: createScheme(),
+func New(opts ...Option) Ispector {
+	sp := Ispector{
+		parser:  jscan.NewParser[string](64),
+		schemas: NewRegistry(),
+		dates:   defaultDateWindow,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(&sp)
 	}
+	return sp
 }
 
-//TODO: Проверить наличие items
+// frame — открытый объект или массив на уровне level.
+type frame struct {
+	node   *node
+	seen   uint64
+	items  int
+	key    string
+	index  int
+	offset int
+}
+
+// Проверяет заказ по схеме.
+// Бинарный заказ (box.Encoding) сначала переводится в JSON
+// и дальше проверяется как обычный, box.Data заменяется на JSON.
+// Версия схемы берется из box.Version (суффикс темы),
+// иначе из поля schema_version, иначе DefaultVersion.
+// При ошибке в box.Err *ValidationError,
+// а в режиме CollectAll — ValidationErrors.
 func (sp Ispector) Audit(box OrderBox) OrderBox {
+	// До разбора версия неизвестна, поэтому сначала
+	// общий предел — самый большой из пределов версий.
+	if max := sp.schemas.maxBytes; max > 0 && len(box.Data) > max {
+		return sp.reject(box, tooLarge(len(box.Data), max))
+	}
 
-	if len(box.Data) > maxLenData {
-		box.Err = errors.New("max len m Data")
+	if box.Encoding != EncodingJSON {
+		box = sp.decode(box)
+		if box.Err != nil {
+			return sp.reject(box, box.Err)
+		}
+	}
+
+	// С одной версией второй проход не нужен,
+	// поле schema_version все равно сверится ниже.
+	if box.Version == "" && len(sp.schemas.versions) > 1 {
+		box.Version = sp.scanVersion(box.Data)
+	}
+
+	ver, ok := sp.schemas.lookup(box.Version)
+	if !ok {
+		box.Err = &ValidationError{
+			Code:    CodeUnknownVersion,
+			Pointer: "/" + versionKey,
+			Actual:  box.Version,
+		}
 		return box
 	}
+	if box.Version == "" {
+		box.Version = sp.schemas.def
+	}
 
-	iter_keys := 0
+	limits := ver.limits
+	if limits.MaxBytes > 0 && len(box.Data) > limits.MaxBytes {
+		return sp.reject(box, tooLarge(len(box.Data), limits.MaxBytes))
+	}
 
-	err := sp.parser.Scan(unsafeB2S(box.Data), func(i *jscan.Iterator[string]) (err bool) {
-		if k := i.Key(); k != "" {
-			key := k[1 : len(k)-1]
+	var (
+		frames [maxDepth]frame
+		top    = -1
+		skip   = -1
+		errs   ValidationErrors
 
-			schemaRow, ok := sp.schema[key]
-			if !ok {
-				box.Err = fmt.Errorf("unregistered key found: %s", key)
-				return true
+		now = sp.now()
+
+		// Для сверки date_created и payment_dt после разбора.
+		created, paid time.Time
+		paidFrames    [maxDepth]frame
+		paidLevel     int
+		paidKey       string
+		paidOffset    int
+	)
+
+	// report сохраняет ошибку и сообщает, нужно ли прервать разбор.
+	report := func(e *ValidationError) bool {
+		errs = append(errs, e)
+		return !sp.collectAll
+	}
+
+	// closeFrames закрывает все открытые значения начиная с level
+	// и проверяет, что в них ничего не пропущено.
+	closeFrames := func(level int) bool {
+		for ; top >= level; top-- {
+			f := &frames[top]
+
+			if f.node.Type == jscan.ValueTypeArray {
+				if f.items < f.node.MinItems && report(&ValidationError{
+					Code:     CodeEmptyArray,
+					Pointer:  pointer(frames[1 : top+1]),
+					Expected: strconv.Itoa(f.node.MinItems),
+					Actual:   strconv.Itoa(f.items),
+					Offset:   f.offset,
+				}) {
+					return true
+				}
+				continue
 			}
 
-			if schemaRow.Type != i.ValueType() {
-				box.Err = fmt.Errorf("%s: audit type expected", key)
-				return true
+			if f.seen == f.node.full() {
+				continue
+			}
+			for n, fl := range f.node.Fields {
+				if f.seen&(1<<n) != 0 {
+					continue
+				}
+				if report(&ValidationError{
+					Code:     CodeMissingKey,
+					Pointer:  pointer(frames[1:top+1]) + "/" + fl.Name,
+					Expected: fl.Value.expected(),
+					Offset:   f.offset,
+				}) {
+					return true
+				}
 			}
+		}
+		return false
+	}
 
-			if key == "order_uid" {
-				val := i.Value()
-				box.Uid = val[1 : len(val)-1]
+	err := sp.parser.Scan(unsafeB2S(box.Data), func(i *jscan.Iterator[string]) (err bool) {
+		level := i.Level()
+
+		if closeFrames(level) {
+			return true
+		}
+
+		// Внутренности отвергнутого значения не проверяем.
+		if skip >= 0 {
+			if level > skip {
+				return false
 			}
+			skip = -1
+		}
 
-			if key == "date_created" {
-				val := i.Value()
-				t, err := time.Parse(time.RFC3339, val[1:len(val)-1])
-				if err != nil {
-					box.Err = err
-					return true
+		schemaRow := ver.schema
+		key, index := "", -1
+
+		if level > 0 {
+			parent := &frames[level-1]
+
+			if parent.node.Type == jscan.ValueTypeObject {
+				k := i.Key()
+				key = k[1 : len(k)-1]
+
+				if level == 1 && key == versionKey {
+					val := i.Value()
+					if i.ValueType() != jscan.ValueTypeString || val[1:len(val)-1] != box.Version {
+						skip = level
+						return report(&ValidationError{
+							Code:     CodeInvalidValue,
+							Pointer:  i.Pointer(),
+							Expected: box.Version,
+							Actual:   strings.Clone(val),
+							Offset:   i.ValueIndex(),
+						})
+					}
+					return false
+				}
+
+				row, n, ok := parent.node.lookup(key)
+				if !ok {
+					skip = level
+					return report(&ValidationError{
+						Code:    CodeUnknownKey,
+						Pointer: i.Pointer(),
+						Offset:  i.KeyIndex(),
+					})
+				}
+				if parent.seen&(1<<n) != 0 {
+					skip = level
+					return report(&ValidationError{
+						Code:    CodeDuplicateKey,
+						Pointer: i.Pointer(),
+						Offset:  i.KeyIndex(),
+					})
+				}
+				parent.seen |= 1 << n
+				schemaRow = row
+			} else {
+				schemaRow = parent.node.Elem
+				index = parent.items
+				parent.items++
+
+				// Лишние товары дальше не разбираем.
+				if limits.MaxItems > 0 && parent.items > limits.MaxItems {
+					skip = level - 1
+					return report(&ValidationError{
+						Code:     CodeTooManyItems,
+						Pointer:  i.Pointer(),
+						Expected: strconv.Itoa(limits.MaxItems),
+						Actual:   strconv.Itoa(parent.items),
+						Offset:   i.ValueIndex(),
+					})
+				}
+			}
+		}
+
+		if schemaRow.Type != i.ValueType() {
+			skip = level
+			return report(&ValidationError{
+				Code:     CodeTypeMismatch,
+				Pointer:  i.Pointer(),
+				Expected: schemaRow.expected(),
+				Actual:   i.ValueType().String(),
+				Offset:   i.ValueIndex(),
+			})
+		}
+
+		// Числа в схеме только целые, им место в BIGINT.
+		if schemaRow.Type == jscan.ValueTypeNumber {
+			val := i.Value()
+			if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+				code, expected := CodeInvalidValue, "integer"
+				if errors.Is(err, strconv.ErrRange) {
+					code, expected = CodeOutOfRange, "int64"
 				}
+				return report(&ValidationError{
+					Code:     code,
+					Pointer:  i.Pointer(),
+					Expected: expected,
+					Actual:   strings.Clone(val),
+					Offset:   i.ValueIndex(),
+				})
+			}
+		}
+
+		if level == 1 && key == "order_uid" {
+			val := i.Value()
+			box.Uid = val[1 : len(val)-1]
+		}
+		if level == 1 && key == sp.partitionKey && schemaRow.Type == jscan.ValueTypeString {
+			val := i.Value()
+			box.Key = val[1 : len(val)-1]
+		}
+
+		if schemaRow.Format != "" {
+			val := i.Value()
+			t, ok := parseFormat(schemaRow.Format, val)
+			if !ok {
+				return report(&ValidationError{
+					Code:     CodeInvalidValue,
+					Pointer:  i.Pointer(),
+					Expected: schemaRow.Format,
+					Actual:   strings.Clone(val),
+					Offset:   i.ValueIndex(),
+				})
+			}
+			if bound := sp.dates.check(t, now); bound != "" {
+				return report(&ValidationError{
+					Code:     CodeOutOfRange,
+					Pointer:  i.Pointer(),
+					Expected: bound,
+					Actual:   strings.Clone(val),
+					Offset:   i.ValueIndex(),
+				})
+			}
+
+			switch {
+			case level == 1 && key == "date_created":
+				created = t
 				box.Rang = t.UnixNano()
+			case schemaRow.Format == FormatUnixTime && paid.IsZero():
+				paid = t
+				paidFrames, paidLevel, paidKey = frames, level, key
+				paidOffset = i.ValueIndex()
 			}
+		}
 
-			if i.Level() == 1 {
-				iter_keys++
+		if schemaRow.Type == jscan.ValueTypeObject || schemaRow.Type == jscan.ValueTypeArray {
+			top = level
+			frames[level] = frame{
+				node:   schemaRow,
+				key:    key,
+				index:  index,
+				offset: i.ValueIndex(),
 			}
 		}
 		return false
 	})
 
-	if err.IsErr() {
-		box.Err = err
-		return box
+	switch {
+	case !err.IsErr():
+		if closeFrames(0) {
+			break
+		}
+		if !created.IsZero() && !paid.IsZero() && !sp.dates.consistent(created, paid) {
+			report(&ValidationError{
+				Code:     CodeInconsistent,
+				Pointer:  pointer(paidFrames[1:paidLevel]) + "/" + paidKey,
+				Expected: "date_created ± " + sp.dates.PaymentSkew.String(),
+				Actual:   strconv.FormatInt(paid.Unix(), 10),
+				Offset:   paidOffset,
+			})
+		}
+	case err.Code != jscan.ErrorCodeCallback:
+		errs = append(errs, &ValidationError{
+			Code:   CodeSyntax,
+			Offset: err.Index,
+		})
 	}
 
-	if iter_keys != Keys {
-		box.Err = errors.New("number of keys mismatch")
+	switch {
+	case len(errs) == 0:
+		ver.accepted.Add(1)
 		return box
+	case sp.collectAll:
+		box.Err = errs
+	default:
+		box.Err = errs[0]
 	}
 
+	ver.reject(box.Err)
+	return box
+}
+
+// reject отвергает заказ до разбора
+// и считает отказ на версию, если она уже известна.
+func (sp Ispector) reject(box OrderBox, err error) OrderBox {
+	box.Err = err
+	if box.Version == "" && len(sp.schemas.versions) > 1 {
+		return box
+	}
+	if ver, ok := sp.schemas.lookup(box.Version); ok {
+		ver.reject(err)
+	}
 	return box
 }
+
+func tooLarge(n, max int) *ValidationError {
+	return &ValidationError{
+		Code:     CodeTooLarge,
+		Expected: strconv.Itoa(max),
+		Actual:   strconv.Itoa(n),
+	}
+}
+
+// scanVersion ищет schema_version среди ключей первого уровня.
+func (sp Ispector) scanVersion(data []byte) string {
+	var name string
+	sp.parser.Scan(unsafeB2S(data), func(i *jscan.Iterator[string]) (err bool) {
+		if i.Level() != 1 || i.ValueType() != jscan.ValueTypeString {
+			return false
+		}
+		if k := i.Key(); len(k) > 2 && k[1:len(k)-1] == versionKey {
+			val := i.Value()
+			name = val[1 : len(val)-1]
+			return true
+		}
+		return false
+	})
+	return name
+}
+
+// pointer собирает JSON pointer по открытым значениям.
+// Ключи берутся из схемы, поэтому экранирование не нужно.
+func pointer(frames []frame) string {
+	var sb strings.Builder
+	for _, f := range frames {
+		sb.WriteByte('/')
+		if f.index < 0 {
+			sb.WriteString(f.key)
+			continue
+		}
+		sb.WriteString(strconv.Itoa(f.index))
+	}
+	return sb.String()
+}
@@ -1,7 +1,16 @@
 package inspector
 
 import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"0lvl/internal/schema"
 )
 
 func TestIspector_Audit(t *testing.T) {
@@ -37,6 +46,311 @@ func TestIspector_Audit(t *testing.T) {
 	}
 }
 
+func TestIspector_AuditErrors(t *testing.T) {
+	ins := New()
+	tests := []struct {
+		name    string
+		data    string
+		code    ErrorCode
+		pointer string
+	}{
+		{"not_key", strings.Replace(ord_valid, `"order_uid": "b563feb7b2b84b6test",`, ``, 1), CodeMissingKey, "/order_uid"},
+		{"not_items", ord_not_items, CodeEmptyArray, "/items"},
+		{"unknown_key", strings.Replace(ord_valid, `"zip"`, `"zap"`, 1), CodeUnknownKey, "/delivery/zap"},
+		{"nested_missing", strings.Replace(ord_valid, `"bank": "alpha",`, ``, 1), CodeMissingKey, "/payment/bank"},
+		{"item_type", strings.Replace(ord_valid, `"price": 453`, `"price": "453"`, 1), CodeTypeMismatch, "/items/0/price"},
+		{"duplicate", strings.Replace(ord_valid, `"entry": "WBIL",`, `"entry": "WBIL", "entry": "WBIL",`, 1), CodeDuplicateKey, "/entry"},
+		{"date", strings.Replace(ord_valid, `2021-11-26T06:22:19Z`, `26.11.2021`, 1), CodeInvalidValue, "/date_created"},
+		{"fraction", strings.Replace(ord_valid, `"price": 453`, `"price": 453.5`, 1), CodeInvalidValue, "/items/0/price"},
+		{"exponent", strings.Replace(ord_valid, `"sm_id": 99`, `"sm_id": 9.9e1`, 1), CodeInvalidValue, "/sm_id"},
+		{"overflow", strings.Replace(ord_valid, `"amount": 1817`, `"amount": 99999999999999999999`, 1), CodeOutOfRange, "/payment/amount"},
+		{"syntax", ord_valid[:100], CodeSyntax, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newBox := ins.Audit(OrderBox{Data: []byte(tt.data)})
+			var verr *ValidationError
+			if !errors.As(newBox.Err, &verr) {
+				t.Fatalf("expected *ValidationError, got %v", newBox.Err)
+			}
+			if verr.Code != tt.code || verr.Pointer != tt.pointer {
+				t.Errorf("got %s %q, want %s %q", verr.Code, verr.Pointer, tt.code, tt.pointer)
+			}
+		})
+	}
+}
+
+func TestIspector_AuditCollectAll(t *testing.T) {
+	ins := New(CollectAll())
+	data := strings.Replace(ord_valid, `"zip"`, `"zap"`, 1)
+	data = strings.Replace(data, `"sm_id": 99`, `"sm_id": "99"`, 1)
+
+	newBox := ins.Audit(OrderBox{Data: []byte(data)})
+	errs := Errors(newBox.Err)
+
+	want := []string{"/delivery/zap", "/delivery/zip", "/sm_id"}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), newBox.Err)
+	}
+	for i, p := range want {
+		if errs[i].Pointer != p {
+			t.Errorf("error %d: got pointer %q, want %q", i, errs[i].Pointer, p)
+		}
+	}
+}
+
+func TestIspector_AuditVersions(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Register("2", withComment(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("2", schema.Order); err == nil {
+		t.Error("expected error for registered version")
+	}
+	ins := New(WithRegistry(reg))
+
+	withVersion := func(version string, extra string) string {
+		return strings.Replace(ord_valid, `"entry": "WBIL",`, `"entry": "WBIL", "schema_version": "`+version+`",`+extra, 1)
+	}
+
+	tests := []struct {
+		name    string
+		box     OrderBox
+		version string
+		code    ErrorCode
+	}{
+		{"default", OrderBox{Data: []byte(ord_valid)}, "1", ""},
+		{"field_v1", OrderBox{Data: []byte(withVersion("1", ""))}, "1", ""},
+		{"field_v2", OrderBox{Data: []byte(withVersion("2", ` "comment": "",`))}, "2", ""},
+		{"field_v2_missing", OrderBox{Data: []byte(withVersion("2", ""))}, "2", CodeMissingKey},
+		{"subject_v2", OrderBox{Version: "2", Data: []byte(strings.Replace(ord_valid, `"entry": "WBIL",`, `"entry": "WBIL", "comment": "",`, 1))}, "2", ""},
+		{"subject_field_conflict", OrderBox{Version: "1", Data: []byte(withVersion("2", ` "comment": "",`))}, "1", CodeInvalidValue},
+		{"unknown", OrderBox{Data: []byte(withVersion("3", ""))}, "3", CodeUnknownVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newBox := ins.Audit(tt.box)
+			if newBox.Version != tt.version {
+				t.Errorf("got version %q, want %q", newBox.Version, tt.version)
+			}
+			var code ErrorCode
+			if errs := Errors(newBox.Err); len(errs) > 0 {
+				code = errs[0].Code
+			}
+			if code != tt.code {
+				t.Errorf("got code %q, want %q: %v", code, tt.code, newBox.Err)
+			}
+		})
+	}
+
+	want := []VersionStats{
+		{Version: "1", Accepted: 2, Rejected: 1, Rejections: map[ErrorCode]uint64{CodeInvalidValue: 1}},
+		{Version: "2", Accepted: 2, Rejected: 1, Rejections: map[ErrorCode]uint64{CodeMissingKey: 1}},
+	}
+	if got := reg.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stats %v, want %v", got, want)
+	}
+}
+
+// withComment — описание заказа с лишним полем comment, как версия 2.
+func withComment(t *testing.T) *schema.Definition {
+	t.Helper()
+	b, err := json.Marshal(schema.Order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := schema.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := def.Lookup(def.Root)
+	root.Fields = append(root.Fields, schema.Field{Key: "comment", Number: 15, Name: "Comment", Type: schema.TypeString})
+	return def
+}
+
+func TestRegistry_RegisterFile(t *testing.T) {
+	// Описание из order.json дает ту же схему, что и сгенерированная.
+	if !reflect.DeepEqual(schemeOf(schema.Order, schema.Order.Root), createScheme()) {
+		t.Error("scheme from definition differs from createScheme")
+	}
+
+	b, err := json.Marshal(withComment(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "order.v2.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := NewRegistry()
+	if err := reg.RegisterFile("2=" + path); err != nil {
+		t.Fatal(err)
+	}
+	if got := reg.Versions(); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("got versions %v", got)
+	}
+	data := strings.Replace(ord_valid, `"entry": "WBIL",`, `"entry": "WBIL", "schema_version": "2", "comment": "",`, 1)
+	if newBox := New(WithRegistry(reg)).Audit(OrderBox{Data: []byte(data)}); newBox.Err != nil {
+		t.Error(newBox.Err)
+	}
+
+	for _, s := range []string{path, "3=", "3=" + path + ".missing", "1=" + path} {
+		if err := reg.RegisterFile(s); err == nil {
+			t.Errorf("RegisterFile(%q): expected error", s)
+		}
+	}
+}
+
+func TestIspector_AuditDates(t *testing.T) {
+	ins := New(WithDateWindow(DateWindow{
+		MaxFuture:   5 * time.Minute,
+		MaxAge:      365 * 24 * time.Hour,
+		PaymentSkew: time.Hour,
+	}))
+	now := time.Date(2021, 11, 26, 12, 0, 0, 0, time.UTC)
+	ins.now = func() time.Time { return now }
+
+	created := func(s string) string {
+		return strings.Replace(ord_valid, `2021-11-26T06:22:19Z`, s, 1)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		code    ErrorCode
+		pointer string
+	}{
+		{"valid", ord_valid, "", ""},
+		{"timezone", strings.Replace(created(`2021-11-26T09:22:19+03:00`), `1637907727`, `1637907739`, 1), "", ""},
+		{"future", created(`2021-11-26T12:10:00Z`), CodeOutOfRange, "/date_created"},
+		{"too_old", created(`2019-11-26T06:22:19Z`), CodeOutOfRange, "/date_created"},
+		{"before_epoch", created(`1969-12-31T23:59:59Z`), CodeOutOfRange, "/date_created"},
+		{"payment_zero", strings.Replace(ord_valid, `1637907727`, `0`, 1), CodeOutOfRange, "/payment/payment_dt"},
+		{"payment_float", strings.Replace(ord_valid, `1637907727`, `1637907727.5`, 1), CodeInvalidValue, "/payment/payment_dt"},
+		{"payment_skew", strings.Replace(ord_valid, `1637907727`, `1637800000`, 1), CodeInconsistent, "/payment/payment_dt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newBox := ins.Audit(OrderBox{Data: []byte(tt.data)})
+			var code ErrorCode
+			var pointer string
+			if errs := Errors(newBox.Err); len(errs) > 0 {
+				code, pointer = errs[0].Code, errs[0].Pointer
+			}
+			if code != tt.code || pointer != tt.pointer {
+				t.Errorf("got %q %q, want %q %q: %v", code, pointer, tt.code, tt.pointer, newBox.Err)
+			}
+		})
+	}
+}
+
+// Нулевые границы не ограничивают ни будущее, ни прошлое.
+func TestDateWindow_Unbounded(t *testing.T) {
+	now := time.Date(2021, 11, 26, 12, 0, 0, 0, time.UTC)
+	for _, d := range []time.Time{now.AddDate(50, 0, 0), now.AddDate(-50, 0, 0)} {
+		if bound := (DateWindow{}).check(d, now); bound != "" {
+			t.Errorf("%s: got bound %q", d, bound)
+		}
+	}
+}
+
+func TestIspector_AuditLimits(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetDefaultLimits(Limits{MaxBytes: 2048, MaxItems: 1})
+	ins := New(WithRegistry(reg))
+
+	item := ord_valid[strings.Index(ord_valid, "{\n\t\t\"chrt_id\""):strings.Index(ord_valid, "\n\t],")]
+	twoItems := strings.Replace(ord_valid, item, item+","+item, 1)
+
+	tests := []struct {
+		name string
+		data string
+		code ErrorCode
+	}{
+		{"valid", ord_valid, ""},
+		{"too_large", ord_valid + strings.Repeat(" ", 2048), CodeTooLarge},
+		{"too_many_items", twoItems, CodeTooManyItems},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newBox := ins.Audit(OrderBox{Data: []byte(tt.data)})
+			var code ErrorCode
+			if errs := Errors(newBox.Err); len(errs) > 0 {
+				code = errs[0].Code
+			}
+			if code != tt.code {
+				t.Errorf("got %q, want %q: %v", code, tt.code, newBox.Err)
+			}
+		})
+	}
+
+	st := reg.Stats()[0]
+	if st.Rejections[CodeTooLarge] != 1 || st.Rejections[CodeTooManyItems] != 1 {
+		t.Errorf("unexpected rejections: %v", st.Rejections)
+	}
+
+	// Отдельная версия со своими пределами поднимает общий предел.
+	if err := reg.Register("2", schema.Order); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetLimits("2", Limits{MaxBytes: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if reg.maxBytes != 1<<20 {
+		t.Errorf("got max bytes %d", reg.maxBytes)
+	}
+	if err := reg.SetLimits("3", Limits{}); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
+
+func TestIspector_AuditPartitionKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", ""},
+		{"customer_id", "test"},
+		{"order_uid", "b563feb7b2b84b6test"},
+		// Не строка и не первый уровень.
+		{"sm_id", ""},
+		{"city", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			newBox := New(WithPartitionKey(tt.key)).Audit(OrderBox{Data: []byte(ord_valid)})
+			if newBox.Err != nil {
+				t.Fatal(newBox.Err)
+			}
+			if newBox.Key != tt.want {
+				t.Errorf("got key %q, want %q", newBox.Key, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		in      string
+		version string
+		limits  Limits
+		ok      bool
+	}{
+		{"2=65536/512", "2", Limits{65536, 512}, true},
+		{"2=65536", "2", Limits{MaxBytes: 65536}, true},
+		{"2=/512", "2", Limits{MaxItems: 512}, true},
+		{"65536/512", "", Limits{}, false},
+		{"2=big", "", Limits{}, false},
+	}
+	for _, tt := range tests {
+		version, limits, err := ParseLimits(tt.in)
+		if (err == nil) != tt.ok || version != tt.version || limits != tt.limits {
+			t.Errorf("ParseLimits(%q) = %q, %v, %v", tt.in, version, limits, err)
+		}
+	}
+}
+
 const ord_valid = `{
 	"order_uid": "b563feb7b2b84b6test",
 	"track_number": "WBILMTESTTRACK",
@@ -156,4 +470,4 @@ const ord_not_key = `{
 	"sm_id": 99,
 	"date_created": "2021-11-26T06:22:19Z",
 	"oof_shard": "1"
-}`
\ No newline at end of file
+}`
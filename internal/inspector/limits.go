@@ -0,0 +1,84 @@
+package inspector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits — пределы размера заказа, 0 — без ограничения.
+type Limits struct {
+	// Размер JSON в байтах, для бинарных форматов — после перевода в JSON.
+	MaxBytes int
+	// Количество товаров в items.
+	MaxItems int
+}
+
+// DefaultLimits действуют для версий без своих пределов.
+var DefaultLimits = Limits{
+	MaxBytes: maxLenData,
+}
+
+// ParseLimits разбирает пределы версии в виде "2=65536/512",
+// "2=65536" или "2=/512".
+func ParseLimits(s string) (string, Limits, error) {
+	var l Limits
+
+	version, rest, ok := strings.Cut(s, "=")
+	if !ok || version == "" {
+		return "", l, fmt.Errorf("limits %q: expected version=bytes/items", s)
+	}
+
+	bytes, items, _ := strings.Cut(rest, "/")
+	var err error
+	if bytes != "" {
+		if l.MaxBytes, err = strconv.Atoi(bytes); err != nil || l.MaxBytes < 0 {
+			return "", l, fmt.Errorf("limits %q: bad bytes", s)
+		}
+	}
+	if items != "" {
+		if l.MaxItems, err = strconv.Atoi(items); err != nil || l.MaxItems < 0 {
+			return "", l, fmt.Errorf("limits %q: bad items", s)
+		}
+	}
+	return version, l, nil
+}
+
+// SetDefaultLimits задает пределы для всех версий без своих.
+// Как и SetLimits, вызывается до запуска подписчиков.
+func (r *Registry) SetDefaultLimits(l Limits) {
+	r.limits = l
+	for _, v := range r.versions {
+		if !v.ownLimits {
+			v.limits = l
+		}
+	}
+	r.updateMaxBytes()
+}
+
+// SetLimits задает пределы отдельной версии.
+func (r *Registry) SetLimits(name string, l Limits) error {
+	v, ok := r.versions[name]
+	if !ok {
+		return fmt.Errorf("limits: unknown schema version %q", name)
+	}
+	v.limits = l
+	v.ownLimits = true
+	r.updateMaxBytes()
+	return nil
+}
+
+// updateMaxBytes считает общий предел, который проверяется
+// до того, как станет известна версия.
+func (r *Registry) updateMaxBytes() {
+	r.maxBytes = 0
+	for _, v := range r.versions {
+		if v.limits.MaxBytes == 0 {
+			r.maxBytes = 0
+			return
+		}
+		if v.limits.MaxBytes > r.maxBytes {
+			r.maxBytes = v.limits.MaxBytes
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package inspector
+
+import "time"
+
+// Message — сообщение брокера с заказом.
+// Ресивер решает его судьбу после проверки и сохранения заказа.
+type Message interface {
+	Data() []byte
+	Subject() string
+	// Время публикации.
+	Timestamp() time.Time
+	// Транспорт, из которого пришло сообщение: stan, jetstream.
+	Source() string
+
+	// Ack — заказ обработан.
+	Ack() error
+	// Nak — доставить снова.
+	Nak() error
+	// Term — больше не доставлять, заказ уже в dead letter.
+	Term() error
+	// InProgress — обработка идет, не доставлять повторно по таймауту.
+	InProgress() error
+}
@@ -0,0 +1,206 @@
+package inspector
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// decodeMsgpack переводит MessagePack в JSON.
+// Поддерживается то, что выражается в JSON:
+// map со строковыми ключами, массивы, строки, числа, bool и nil.
+func decodeMsgpack(dst, src []byte) ([]byte, error) {
+	d := msgpackDecoder{src: src}
+	dst, err := d.value(dst, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(src) {
+		return nil, syntaxError(d.pos)
+	}
+	return dst, nil
+}
+
+type msgpackDecoder struct {
+	src []byte
+	pos int
+}
+
+// take возвращает следующие n байт.
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || len(d.src)-d.pos < n {
+		return nil, syntaxError(d.pos)
+	}
+	b := d.src[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint читает беззнаковое целое длиной size байт.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *msgpackDecoder) value(dst []byte, depth int) ([]byte, error) {
+	if depth >= maxDepth {
+		return nil, syntaxError(d.pos)
+	}
+
+	start := d.pos
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return strconv.AppendUint(dst, uint64(c), 10), nil
+	case c >= 0xe0:
+		return strconv.AppendInt(dst, int64(int8(c)), 10), nil
+	case c&0xf0 == 0x80:
+		return d.object(dst, int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.array(dst, int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(dst, int(c&0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return append(dst, "null"...), nil
+	case 0xc2:
+		return append(dst, "false"...), nil
+	case 0xc3:
+		return append(dst, "true"...), nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendUint(dst, n, 10), nil
+
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Расширяем знак до 64 бит.
+		shift := 64 - size*8
+		return strconv.AppendInt(dst, int64(n<<shift)>>shift, 10), nil
+
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return appendFloat(dst, float64(math.Float32frombits(uint32(n))), start)
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return appendFloat(dst, math.Float64frombits(n), start)
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(dst, int(n))
+
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(dst, int(n), depth)
+
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(dst, int(n), depth)
+	}
+
+	// bin, ext и зарезервированный 0xc1 в JSON не переводятся.
+	return nil, syntaxError(start)
+}
+
+func (d *msgpackDecoder) str(dst []byte, n int) ([]byte, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return appendString(dst, unsafeB2S(b)), nil
+}
+
+func (d *msgpackDecoder) array(dst []byte, n int, depth int) ([]byte, error) {
+	var err error
+	dst = append(dst, '[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst, err = d.value(dst, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (d *msgpackDecoder) object(dst []byte, n int, depth int) ([]byte, error) {
+	dst = append(dst, '{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+
+		// Ключ обязан быть строкой.
+		start := d.pos
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		var size uint64
+		switch c := b[0]; {
+		case c&0xe0 == 0xa0:
+			size = uint64(c & 0x1f)
+		case c == 0xd9 || c == 0xda || c == 0xdb:
+			size, err = d.uint(1 << (c - 0xd9))
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, syntaxError(start)
+		}
+
+		dst, err = d.str(dst, int(size))
+		if err != nil {
+			return nil, err
+		}
+		dst = append(dst, ':')
+
+		dst, err = d.value(dst, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
@@ -0,0 +1,282 @@
+package inspector
+
+import (
+	"strconv"
+
+	"0lvl/internal/schema"
+
+	"github.com/romshark/jscan/v2"
+)
+
+// Protobuf не описывает себя сам, поэтому сообщение разбирается по схеме версии:
+// номера полей из internal/schema/order.json, паблишеры собирают
+// сгенерированный из него order.proto. Строки и вложенные объекты —
+// length-delimited, числа — int64 varint, массив объектов — repeated message.
+//
+// schema_version передается полем protobufVersionField корневого сообщения.
+const protobufVersionField = schema.VersionNumber
+
+// Типы protobuf wire format.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type protoField struct {
+	num  uint64
+	wire byte
+
+	// varint — значение, для bytes — границы содержимого.
+	val        uint64
+	start, end int
+}
+
+// readVarint читает varint с позиции pos.
+func readVarint(src []byte, pos int) (uint64, int, bool) {
+	var x uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if pos >= len(src) {
+			return 0, pos, false
+		}
+		c := src[pos]
+		pos++
+		x |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return x, pos, true
+		}
+	}
+	return 0, pos, false
+}
+
+// nextField читает поле с позиции pos и возвращает позицию следующего.
+func nextField(src []byte, pos int) (protoField, int, error) {
+	var f protoField
+	start := pos
+
+	tag, pos, ok := readVarint(src, pos)
+	if !ok || tag>>3 == 0 {
+		return f, pos, syntaxError(start)
+	}
+	f.num, f.wire = tag>>3, byte(tag&7)
+
+	switch f.wire {
+	case wireVarint:
+		f.val, pos, ok = readVarint(src, pos)
+		if !ok {
+			return f, pos, syntaxError(start)
+		}
+	case wireBytes:
+		var n uint64
+		n, pos, ok = readVarint(src, pos)
+		if !ok || n > uint64(len(src)-pos) {
+			return f, pos, syntaxError(start)
+		}
+		f.start, f.end = pos, pos+int(n)
+		pos = f.end
+	case wireFixed64, wireFixed32:
+		size := 8
+		if f.wire == wireFixed32 {
+			size = 4
+		}
+		if len(src)-pos < size {
+			return f, pos, syntaxError(start)
+		}
+		pos += size
+	default:
+		// Группы устарели и в схеме не встречаются.
+		return f, pos, syntaxError(start)
+	}
+	return f, pos, nil
+}
+
+// protobufVersion ищет schema_version в корневом сообщении.
+func protobufVersion(src []byte) string {
+	var version string
+	for pos := 0; pos < len(src); {
+		f, next, err := nextField(src, pos)
+		if err != nil {
+			return ""
+		}
+		if f.num == protobufVersionField && f.wire == wireBytes {
+			version = string(src[f.start:f.end])
+		}
+		pos = next
+	}
+	return version
+}
+
+// decodeProtobuf переводит сообщение в JSON с ключами в порядке схемы.
+// Как и в proto3, отсутствующие строки и числа становятся "" и 0,
+// а отсутствующий вложенный объект — отсутствующим ключом.
+func decodeProtobuf(dst, src []byte, scheme *node) ([]byte, error) {
+	if err := checkProtobuf(src, scheme, "", true); err != nil {
+		return nil, err
+	}
+
+	dst = append(dst, '{')
+	first := true
+	if version := protobufVersion(src); version != "" {
+		dst = append(dst, `"`+versionKey+`":`...)
+		dst = appendString(dst, version)
+		first = false
+	}
+	dst = appendProtobufFields(dst, src, scheme, first)
+	return append(dst, '}'), nil
+}
+
+// checkProtobuf проверяет номера и типы полей,
+// после нее сообщение можно разбирать без ошибок.
+func checkProtobuf(src []byte, scheme *node, path string, root bool) error {
+	// Сколько раз встретилось каждое поле, нужно для индекса в pointer.
+	var seen [64]int
+
+	for pos := 0; pos < len(src); {
+		f, next, err := nextField(src, pos)
+		if err != nil {
+			return err
+		}
+
+		if root && f.num == protobufVersionField {
+			if f.wire != wireBytes {
+				return protobufMismatch(path+"/"+versionKey, pos, jscan.ValueTypeString, f.wire)
+			}
+			pos = next
+			continue
+		}
+
+		i, ok := scheme.lookupNumber(f.num)
+		if !ok {
+			return &ValidationError{
+				Code:    CodeUnknownKey,
+				Pointer: path + "/" + strconv.FormatUint(f.num, 10),
+				Offset:  pos,
+			}
+		}
+
+		fl := scheme.Fields[i]
+		n := seen[i]
+		seen[i]++
+
+		want := fl.Value
+
+		switch want.Type {
+		case jscan.ValueTypeNumber:
+			if f.wire != wireVarint {
+				return protobufMismatch(path+"/"+fl.Name, pos, want.Type, f.wire)
+			}
+		case jscan.ValueTypeString:
+			if f.wire != wireBytes {
+				return protobufMismatch(path+"/"+fl.Name, pos, want.Type, f.wire)
+			}
+		case jscan.ValueTypeObject:
+			if f.wire != wireBytes {
+				return protobufMismatch(path+"/"+fl.Name, pos, want.Type, f.wire)
+			}
+			if err := checkProtobuf(src[f.start:f.end], want, path+"/"+fl.Name, false); err != nil {
+				return shiftOffset(err, f.start)
+			}
+		case jscan.ValueTypeArray:
+			if f.wire != wireBytes || want.Elem.Type != jscan.ValueTypeObject {
+				return protobufMismatch(path+"/"+fl.Name, pos, want.Type, f.wire)
+			}
+			if err := checkProtobuf(src[f.start:f.end], want.Elem, path+"/"+fl.Name+"/"+strconv.Itoa(n), false); err != nil {
+				return shiftOffset(err, f.start)
+			}
+		}
+		pos = next
+	}
+	return nil
+}
+
+func appendProtobufFields(dst, src []byte, scheme *node, first bool) []byte {
+	for _, fl := range scheme.Fields {
+		num := fl.Num
+
+		// Вложенный объект без единого вхождения опускаем,
+		// пусть Audit сообщит об отсутствующем ключе.
+		if fl.Value.Type == jscan.ValueTypeObject && !hasProtobufField(src, num) {
+			continue
+		}
+
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+		dst = appendString(dst, fl.Name)
+		dst = append(dst, ':')
+
+		switch fl.Value.Type {
+		case jscan.ValueTypeArray:
+			dst = append(dst, '[')
+			n := 0
+			eachProtobufField(src, num, func(f protoField) {
+				if n > 0 {
+					dst = append(dst, ',')
+				}
+				n++
+				dst = append(dst, '{')
+				dst = appendProtobufFields(dst, src[f.start:f.end], fl.Value.Elem, true)
+				dst = append(dst, '}')
+			})
+			dst = append(dst, ']')
+
+		case jscan.ValueTypeObject:
+			// Повторные вхождения сообщения в proto сливаются,
+			// здесь поля просто берутся из последнего.
+			var last protoField
+			eachProtobufField(src, num, func(f protoField) { last = f })
+			dst = append(dst, '{')
+			dst = appendProtobufFields(dst, src[last.start:last.end], fl.Value, true)
+			dst = append(dst, '}')
+
+		case jscan.ValueTypeString:
+			var last protoField
+			eachProtobufField(src, num, func(f protoField) { last = f })
+			dst = appendString(dst, unsafeB2S(src[last.start:last.end]))
+
+		case jscan.ValueTypeNumber:
+			var last protoField
+			eachProtobufField(src, num, func(f protoField) { last = f })
+			dst = strconv.AppendInt(dst, int64(last.val), 10)
+		}
+	}
+	return dst
+}
+
+// eachProtobufField вызывает fn для каждого вхождения поля num.
+// Сообщение уже проверено checkProtobuf.
+func eachProtobufField(src []byte, num uint64, fn func(f protoField)) {
+	for pos := 0; pos < len(src); {
+		f, next, _ := nextField(src, pos)
+		if f.num == num {
+			fn(f)
+		}
+		pos = next
+	}
+}
+
+func hasProtobufField(src []byte, num uint64) bool {
+	found := false
+	eachProtobufField(src, num, func(protoField) { found = true })
+	return found
+}
+
+func protobufMismatch(path string, offset int, want jscan.ValueType, wire byte) *ValidationError {
+	return &ValidationError{
+		Code:     CodeTypeMismatch,
+		Pointer:  path,
+		Expected: want.String(),
+		Actual:   "wire type " + strconv.Itoa(int(wire)),
+		Offset:   offset,
+	}
+}
+
+// shiftOffset переводит смещение во вложенном сообщении в смещение от начала.
+func shiftOffset(err error, base int) error {
+	if e, ok := err.(*ValidationError); ok {
+		e.Offset += base
+	}
+	return err
+}
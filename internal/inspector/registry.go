@@ -0,0 +1,176 @@
+package inspector
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"0lvl/internal/schema"
+
+	"github.com/romshark/jscan/v2"
+)
+
+const (
+	// DefaultVersion — версия схемы для сообщений,
+	// в которых версия не указана ни полем, ни суффиксом темы.
+	DefaultVersion = "1"
+
+	// versionKey допустим в любой версии схемы
+	// и должен совпадать с выбранной версией.
+	versionKey = "schema_version"
+)
+
+type version struct {
+	schema    *node
+	limits    Limits
+	ownLimits bool
+
+	accepted   atomic.Uint64
+	rejected   atomic.Uint64
+	rejections [len(errorCodes)]atomic.Uint64
+}
+
+// reject считает отказ по коду первой ошибки.
+func (v *version) reject(err error) {
+	v.rejected.Add(1)
+	if errs := Errors(err); len(errs) > 0 {
+		if i, ok := errorCodeIndex[errs[0].Code]; ok {
+			v.rejections[i].Add(1)
+		}
+	}
+}
+
+// Registry хранит известные версии схемы заказа.
+// Во время миграции старые и новые паблишеры
+// публикуют одновременно, каждый со своей версией.
+//
+// Один Registry можно разделять между инспекторами разных подписчиков.
+type Registry struct {
+	def      string
+	versions map[string]*version
+
+	limits   Limits
+	maxBytes int
+}
+
+// VersionStats — сколько заказов версии принято и отвергнуто,
+// Rejections — отказы по коду первой ошибки.
+type VersionStats struct {
+	Version    string               `json:"version"`
+	Accepted   uint64               `json:"accepted"`
+	Rejected   uint64               `json:"rejected"`
+	Rejections map[ErrorCode]uint64 `json:"rejections,omitempty"`
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{
+		def:      DefaultVersion,
+		versions: make(map[string]*version),
+		limits:   DefaultLimits,
+	}
+	r.register(DefaultVersion, createScheme())
+	return r
+}
+
+// Register добавляет версию схемы, описанную как internal/schema/order.json.
+// Вызывается до запуска подписчиков: темы версий подписываются при старте.
+func (r *Registry) Register(name string, def *schema.Definition) error {
+	if name == "" {
+		return fmt.Errorf("schema version: empty name")
+	}
+	if _, ok := r.versions[name]; ok {
+		return fmt.Errorf("schema version %q already registered", name)
+	}
+	r.register(name, schemeOf(def, def.Root))
+	return nil
+}
+
+// RegisterFile добавляет версию из файла описания в виде
+// "2=/etc/orders/order.v2.json".
+func (r *Registry) RegisterFile(s string) error {
+	name, path, ok := strings.Cut(s, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("schema version %q: expected version=path", s)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("schema version %s: %w", name, err)
+	}
+	def, err := schema.Parse(b)
+	if err != nil {
+		return fmt.Errorf("schema version %s: %w", name, err)
+	}
+	return r.Register(name, def)
+}
+
+// schemeOf строит схему типа так же, как schemagen строит createScheme.
+func schemeOf(def *schema.Definition, name string) *node {
+	t, _ := def.Lookup(name)
+	fields := make([]field, 0, len(t.Fields))
+	for _, f := range t.Fields {
+		var n *node
+		switch f.Type {
+		case schema.TypeString:
+			n = formatted(jscan.ValueTypeString, f.Format)
+		case schema.TypeInt:
+			n = formatted(jscan.ValueTypeNumber, f.Format)
+		default:
+			elem, isArray := f.Elem()
+			n = schemeOf(def, elem)
+			if isArray {
+				n = array(n, f.MinItems)
+			}
+		}
+		fields = append(fields, field{f.Key, uint64(f.Number), n})
+	}
+	return object(fields...)
+}
+
+func (r *Registry) register(name string, scheme *node) {
+	r.versions[name] = &version{schema: scheme, limits: r.limits}
+	r.updateMaxBytes()
+}
+
+func (r *Registry) lookup(name string) (*version, bool) {
+	if name == "" {
+		name = r.def
+	}
+	v, ok := r.versions[name]
+	return v, ok
+}
+
+// Versions возвращает имена всех версий по порядку.
+func (r *Registry) Versions() []string {
+	names := make([]string, 0, len(r.versions))
+	for name := range r.versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats возвращает счетчики по каждой версии.
+func (r *Registry) Stats() []VersionStats {
+	names := r.Versions()
+	stats := make([]VersionStats, 0, len(names))
+	for _, name := range names {
+		v := r.versions[name]
+		st := VersionStats{
+			Version:  name,
+			Accepted: v.accepted.Load(),
+			Rejected: v.rejected.Load(),
+		}
+		for i, code := range errorCodes {
+			if n := v.rejections[i].Load(); n > 0 {
+				if st.Rejections == nil {
+					st.Rejections = make(map[ErrorCode]uint64)
+				}
+				st.Rejections[code] = n
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
@@ -2,148 +2,94 @@ package inspector
 
 import "github.com/romshark/jscan/v2"
 
-
+// Форматы значений, которые проверяются сверх типа.
 const (
-	Keys = 14
-	ObjKeys = 17
-	ItemKeys = 11
+	// Строка RFC 3339, в хранимом виде приводится к UTC.
+	FormatDateTime = "date-time"
+	// Число секунд Unix.
+	FormatUnixTime = "unix-time"
 )
 
-type value struct {
-	Type jscan.ValueType
-}
+// Схема заказа генерируется в scheme_gen.go из internal/schema/order.json.
 
-func createScheme() map[string]value {
-	scheme := map[string]value{
-		"track_number": {
-			Type: jscan.ValueTypeString,
-		},// order, item
-		"name": {
-			Type: jscan.ValueTypeString,
-		},// delivery, item
+// node описывает ожидаемое значение.
+// Для объекта — ключи в порядке объявления,
+// для массива — схема элемента.
+type node struct {
+	Type   jscan.ValueType
+	Format string
 
-        "order_uid": {
-			Type: jscan.ValueTypeString,
-		},  
-		"entry": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"locale": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"internal_signature": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"customer_id": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"delivery_service": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"shardkey": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"sm_id": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"date_created": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"oof_shard": {
-			Type: jscan.ValueTypeString,
-		}, 
+	Fields  []field
+	index   map[string]int
+	numbers map[uint64]int
 
-		"delivery": {
-			Type: jscan.ValueTypeObject,
-		}, 
-		"phone": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"zip": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"city": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"address": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"region": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"email": {
-			Type: jscan.ValueTypeString,
-		}, 
+	Elem     *node
+	MinItems int
+}
 
-		"payment": {
-			Type: jscan.ValueTypeObject,
-		}, 
-		"transaction": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"request_id": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"currency": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"provider": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"amount": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"payment_dt": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"bank": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"delivery_cost": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"goods_total": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"custom_fee": {
-			Type: jscan.ValueTypeNumber,
-		}, 
+type field struct {
+	Name string
+	// Num — номер поля в order.proto.
+	Num   uint64
+	Value *node
+}
 
-		"items": {
-			Type: jscan.ValueTypeArray,
-		}, 
-		"chrt_id": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"price": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"rid": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"sale": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"size": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"total_price": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"nm_id": {
-			Type: jscan.ValueTypeNumber,
-		}, 
-		"brand": {
-			Type: jscan.ValueTypeString,
-		}, 
-		"status": {
-			Type: jscan.ValueTypeNumber,
-		}, 
+// lookup возвращает схему ключа и его порядковый номер в объекте.
+func (n *node) lookup(key string) (*node, int, bool) {
+	i, ok := n.index[key]
+	if !ok {
+		return nil, 0, false
+	}
+	return n.Fields[i].Value, i, true
+}
 
-    }
+// lookupNumber возвращает порядковый номер поля protobuf в объекте.
+func (n *node) lookupNumber(num uint64) (int, bool) {
+	i, ok := n.numbers[num]
+	return i, ok
+}
 
-	return scheme
+// expected — тип значения для ValidationError.Expected.
+// Числа в схеме только целые, см. schema.TypeInt.
+func (n *node) expected() string {
+	if n.Type == jscan.ValueTypeNumber {
+		return "integer"
+	}
+	return n.Type.String()
 }
 
+// full — маска, в которой отмечены все ключи объекта.
+func (n *node) full() uint64 {
+	return 1<<len(n.Fields) - 1
+}
 
+func scalar(t jscan.ValueType) *node {
+	return &node{Type: t}
+}
+
+func formatted(t jscan.ValueType, format string) *node {
+	return &node{Type: t, Format: format}
+}
 
+// object собирает схему объекта, не более 64 ключей.
+func object(fields ...field) *node {
+	n := &node{
+		Type:    jscan.ValueTypeObject,
+		Fields:  fields,
+		index:   make(map[string]int, len(fields)),
+		numbers: make(map[uint64]int, len(fields)),
+	}
+	for i, f := range fields {
+		n.index[f.Name] = i
+		n.numbers[f.Num] = i
+	}
+	return n
+}
+
+func array(elem *node, minItems int) *node {
+	return &node{
+		Type:     jscan.ValueTypeArray,
+		Elem:     elem,
+		MinItems: minItems,
+	}
+}
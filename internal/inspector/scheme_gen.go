@@ -0,0 +1,73 @@
+// Code generated by schemagen from internal/schema/order.json. DO NOT EDIT.
+
+package inspector
+
+import "github.com/romshark/jscan/v2"
+
+// Keys — ключей в корне заказа, ObjKeys — во вложенных объектах,
+// ItemKeys — в одном товаре.
+const (
+	Keys     = 14
+	ObjKeys  = 17
+	ItemKeys = 11
+)
+
+func createScheme() *node {
+	str := jscan.ValueTypeString
+	num := jscan.ValueTypeNumber
+
+	delivery := object(
+		field{"name", 1, scalar(str)},
+		field{"phone", 2, scalar(str)},
+		field{"zip", 3, scalar(str)},
+		field{"city", 4, scalar(str)},
+		field{"address", 5, scalar(str)},
+		field{"region", 6, scalar(str)},
+		field{"email", 7, scalar(str)},
+	)
+
+	payment := object(
+		field{"transaction", 1, scalar(str)},
+		field{"request_id", 2, scalar(str)},
+		field{"currency", 3, scalar(str)},
+		field{"provider", 4, scalar(str)},
+		field{"amount", 5, scalar(num)},
+		field{"payment_dt", 6, formatted(num, FormatUnixTime)},
+		field{"bank", 7, scalar(str)},
+		field{"delivery_cost", 8, scalar(num)},
+		field{"goods_total", 9, scalar(num)},
+		field{"custom_fee", 10, scalar(num)},
+	)
+
+	item := object(
+		field{"chrt_id", 1, scalar(num)},
+		field{"track_number", 2, scalar(str)},
+		field{"price", 3, scalar(num)},
+		field{"rid", 4, scalar(str)},
+		field{"name", 5, scalar(str)},
+		field{"sale", 6, scalar(num)},
+		field{"size", 7, scalar(str)},
+		field{"total_price", 8, scalar(num)},
+		field{"nm_id", 9, scalar(num)},
+		field{"brand", 10, scalar(str)},
+		field{"status", 11, scalar(num)},
+	)
+
+	return object(
+		field{"order_uid", 1, scalar(str)},
+		field{"track_number", 2, scalar(str)},
+		field{"entry", 3, scalar(str)},
+		field{"delivery", 4, delivery},
+		field{"payment", 5, payment},
+		// Заказ без товаров не принимаем.
+		field{"items", 6, array(item, 1)},
+		field{"locale", 7, scalar(str)},
+		field{"internal_signature", 8, scalar(str)},
+		field{"customer_id", 9, scalar(str)},
+		field{"delivery_service", 10, scalar(str)},
+		field{"shardkey", 11, scalar(str)},
+		field{"sm_id", 12, scalar(num)},
+		field{"date_created", 13, formatted(str, FormatDateTime)},
+		field{"oof_shard", 14, scalar(str)},
+	)
+}
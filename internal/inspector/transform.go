@@ -0,0 +1,356 @@
+package inspector
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/romshark/jscan/v2"
+	"github.com/valyala/fastjson"
+)
+
+type action int8
+
+const (
+	keep action = iota
+	drop
+	mask
+)
+
+// plan повторяет схему версии и говорит, что делать с каждым ключом.
+type plan struct {
+	node   *node
+	fields []action
+	childs []*plan
+	elem   *plan
+	// lax пропускает отсутствующие ключи: заказ мог быть сохранен
+	// при другом DROP_FIELDS или старой версией сервиса.
+	lax bool
+}
+
+// Transformer приводит проверенный заказ к каноническому виду:
+// минифицированный JSON с ключами в порядке схемы, без удаляемых полей,
+// даты в UTC.
+// Для публичного представления дополнительно маскирует ПДн.
+//
+// Безопасен для параллельного использования.
+type Transformer struct {
+	parsers fastjson.ParserPool
+
+	stored map[string]*plan
+	public map[string]*plan
+
+	fingerprint string
+}
+
+// NewTransformer собирает планы для каждой версии схемы.
+// Пути полей через точку: internal_signature, delivery.phone, items.rid.
+func NewTransformer(schemas *Registry, dropFields, maskFields []string) (*Transformer, error) {
+	t := &Transformer{
+		stored: make(map[string]*plan, len(schemas.versions)),
+		public: make(map[string]*plan, len(schemas.versions)),
+	}
+
+	for name, v := range schemas.versions {
+		stored := newPlan(v.schema, false)
+		public := newPlan(v.schema, true)
+
+		for _, path := range dropFields {
+			if err := stored.set(path, drop); err != nil {
+				return nil, fmt.Errorf("schema %s: drop %w", name, err)
+			}
+			public.set(path, drop)
+		}
+		for _, path := range maskFields {
+			if err := public.set(path, mask); err != nil {
+				return nil, fmt.Errorf("schema %s: mask %w", name, err)
+			}
+		}
+
+		t.stored[name] = stored
+		t.public[name] = public
+	}
+
+	h := sha256.New()
+	for _, name := range schemas.Versions() {
+		fmt.Fprintf(h, "version %s\n", name)
+		t.stored[name].describe(h)
+		t.public[name].describe(h)
+	}
+	t.fingerprint = fmt.Sprintf("%x", h.Sum(nil))
+	return t, nil
+}
+
+// Fingerprint — хеш схем всех версий и того, какие поля удаляются
+// и маскируются. Отпечаток меняется вместе с тем, как выглядят
+// сохраненный и отдаваемый заказ, см. repository.LoadCacheSnapshot.
+func (t *Transformer) Fingerprint() string {
+	return t.fingerprint
+}
+
+// describe пишет план в w: ключи, типы, форматы, номера и действия.
+func (p *plan) describe(w io.Writer) {
+	n := p.node
+	fmt.Fprintf(w, "%d %s %d", n.Type, n.Format, n.MinItems)
+	switch {
+	case p.elem != nil:
+		io.WriteString(w, "[")
+		p.elem.describe(w)
+		io.WriteString(w, "]")
+	case p.fields != nil:
+		io.WriteString(w, "{")
+		for i, f := range n.Fields {
+			fmt.Fprintf(w, "%q %d %d ", f.Name, f.Num, p.fields[i])
+			p.childs[i].describe(w)
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "}")
+	}
+}
+
+func newPlan(n *node, lax bool) *plan {
+	p := &plan{node: n, lax: lax}
+	switch {
+	case n.Elem != nil:
+		p.elem = newPlan(n.Elem, lax)
+	case len(n.Fields) > 0:
+		p.fields = make([]action, len(n.Fields))
+		p.childs = make([]*plan, len(n.Fields))
+		for i, f := range n.Fields {
+			p.childs[i] = newPlan(f.Value, lax)
+		}
+	}
+	return p
+}
+
+func (p *plan) set(path string, a action) error {
+	if p.elem != nil {
+		return p.elem.set(path, a)
+	}
+
+	name, rest, nested := strings.Cut(path, ".")
+	_, i, ok := p.node.lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown field %q", path)
+	}
+
+	if nested {
+		return p.childs[i].set(rest, a)
+	}
+	if a == mask && p.node.Fields[i].Value.Type != jscan.ValueTypeString {
+		return fmt.Errorf("field %q is not a string", path)
+	}
+	p.fields[i] = a
+	return nil
+}
+
+// Canonical заменяет box.Data каноническим представлением для хранения.
+// Вызывается после успешного Audit, версия берется из box.Version.
+func (t *Transformer) Canonical(box OrderBox) OrderBox {
+	if box.Version == "" {
+		box.Version = DefaultVersion
+	}
+	p, ok := t.stored[box.Version]
+	if !ok {
+		box.Err = fmt.Errorf("transform: unknown schema version %q", box.Version)
+		return box
+	}
+
+	data, err := t.marshal(p, box.Version, box.Data)
+	if err != nil {
+		box.Err = err
+		return box
+	}
+	box.Data = data
+	return box
+}
+
+// Public возвращает представление заказа для отдачи наружу,
+// с замаскированными ПДн. Ключи, которых нет в заказе, пропускаются.
+func (t *Transformer) Public(data []byte) ([]byte, error) {
+	parser := t.parsers.Get()
+	defer t.parsers.Put(parser)
+
+	v, err := parser.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	version := DefaultVersion
+	if sv := v.GetStringBytes(versionKey); sv != nil {
+		version = string(sv)
+	}
+
+	p, ok := t.public[version]
+	if !ok {
+		return nil, fmt.Errorf("transform: unknown schema version %q", version)
+	}
+
+	dst := make([]byte, 0, len(data))
+	return p.appendObject(dst, version, v)
+}
+
+func (t *Transformer) marshal(p *plan, version string, data []byte) ([]byte, error) {
+	parser := t.parsers.Get()
+	defer t.parsers.Put(parser)
+
+	v, err := parser.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := make([]byte, 0, len(data))
+	return p.appendObject(dst, version, v)
+}
+
+var errTransformType = errors.New("transform: value does not match schema")
+
+// appendObject пишет корень заказа,
+// schema_version попадает в результат только для не основной версии.
+func (p *plan) appendObject(dst []byte, version string, v *fastjson.Value) ([]byte, error) {
+	if v.Type() != fastjson.TypeObject {
+		return nil, errTransformType
+	}
+
+	dst = append(dst, '{')
+	if version != DefaultVersion {
+		dst = append(dst, `"`+versionKey+`":`...)
+		dst = appendString(dst, version)
+		dst = append(dst, ',')
+	}
+	dst, err := p.appendFields(dst, v)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, '}'), nil
+}
+
+func (p *plan) appendValue(dst []byte, v *fastjson.Value) ([]byte, error) {
+	switch {
+	case p.elem != nil:
+		if v.Type() != fastjson.TypeArray {
+			return nil, errTransformType
+		}
+		arr, _ := v.Array()
+
+		dst = append(dst, '[')
+		for i, el := range arr {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			dst, err = p.elem.appendValue(dst, el)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+
+	case p.fields != nil:
+		if v.Type() != fastjson.TypeObject {
+			return nil, errTransformType
+		}
+
+		dst = append(dst, '{')
+		dst, err := p.appendFields(dst, v)
+		if err != nil {
+			return nil, err
+		}
+		return append(dst, '}'), nil
+
+	case p.node.Format == FormatDateTime:
+		// Храним даты в UTC, момент времени не меняется.
+		b, err := v.StringBytes()
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, unsafeB2S(b))
+		if err != nil {
+			return nil, err
+		}
+		dst = append(dst, '"')
+		dst = t.UTC().AppendFormat(dst, time.RFC3339Nano)
+		return append(dst, '"'), nil
+	}
+
+	return v.MarshalTo(dst), nil
+}
+
+func (p *plan) appendFields(dst []byte, v *fastjson.Value) ([]byte, error) {
+	first := true
+	for i, f := range p.node.Fields {
+		if p.fields[i] == drop {
+			continue
+		}
+
+		fv := v.Get(f.Name)
+		if fv == nil && p.lax {
+			continue
+		}
+		if fv == nil {
+			return nil, fmt.Errorf("transform: missing field %q", f.Name)
+		}
+
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+
+		dst = appendString(dst, f.Name)
+		dst = append(dst, ':')
+
+		if p.fields[i] == mask {
+			s, err := fv.StringBytes()
+			if err != nil {
+				return nil, err
+			}
+			dst = appendString(dst, maskString(unsafeB2S(s)))
+			continue
+		}
+
+		var err error
+		dst, err = p.childs[i].appendValue(dst, fv)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// maskString оставляет от e-mail первую букву и домен,
+// от остального — по два символа с краев.
+func maskString(s string) string {
+	if at := strings.LastIndexByte(s, '@'); at > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		return string(r) + strings.Repeat("*", utf8.RuneCountInString(s[size:at])) + s[at:]
+	}
+
+	runes := []rune(s)
+	if len(runes) <= 6 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-2:])
+}
+
+const hex = "0123456789abcdef"
+
+// appendString пишет s как JSON строку.
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,117 @@
+package inspector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTransformer_Canonical(t *testing.T) {
+	reg := NewRegistry()
+	tr, err := NewTransformer(reg, []string{"internal_signature"}, []string{"delivery.phone", "delivery.email", "delivery.address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Тот же заказ с другим порядком ключей и пробелами.
+	reordered := strings.Replace(ord_valid, `"order_uid": "b563feb7b2b84b6test",`, ``, 1)
+	reordered = strings.Replace(reordered, `"oof_shard": "1"`, `"oof_shard": "1", "order_uid": "b563feb7b2b84b6test"`, 1)
+
+	a := tr.Canonical(OrderBox{Data: []byte(ord_valid)})
+	b := tr.Canonical(OrderBox{Data: []byte(reordered)})
+	if a.Err != nil || b.Err != nil {
+		t.Fatal(a.Err, b.Err)
+	}
+	if !bytes.Equal(a.Data, b.Data) {
+		t.Errorf("canonical differs:\n%s\n%s", a.Data, b.Data)
+	}
+	if !bytes.HasPrefix(a.Data, []byte(`{"order_uid":"b563feb7b2b84b6test","track_number":`)) {
+		t.Errorf("unexpected key order: %s", a.Data)
+	}
+	if bytes.Contains(a.Data, []byte("internal_signature")) {
+		t.Errorf("dropped field stored: %s", a.Data)
+	}
+	if !bytes.Contains(a.Data, []byte(`"phone":"+9720000000"`)) {
+		t.Errorf("stored representation must keep pii: %s", a.Data)
+	}
+
+	// Дата хранится в UTC, момент тот же.
+	c := tr.Canonical(OrderBox{Data: []byte(strings.Replace(ord_valid, `2021-11-26T06:22:19Z`, `2021-11-26T09:22:19+03:00`, 1))})
+	if c.Err != nil || !bytes.Equal(c.Data, a.Data) {
+		t.Errorf("date is not normalized to UTC: %s %v", c.Data, c.Err)
+	}
+
+	public, err := tr.Public(a.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"phone":"+9*******00"`, `"email":"t***@gmail.com"`, `"address":"Pl***********15"`, `"name":"Test Testov"`} {
+		if !bytes.Contains(public, []byte(want)) {
+			t.Errorf("public representation has no %s: %s", want, public)
+		}
+	}
+}
+
+func TestTransformer_PublicMissingField(t *testing.T) {
+	// Заказ сохранен при DROP_FIELDS=internal_signature,
+	// сервис перезапущен без него.
+	old, err := NewTransformer(NewRegistry(), []string{"internal_signature"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := old.Canonical(OrderBox{Data: []byte(ord_valid)})
+	if stored.Err != nil {
+		t.Fatal(stored.Err)
+	}
+
+	tr, err := NewTransformer(NewRegistry(), nil, []string{"delivery.phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := tr.Public(stored.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(public, []byte("internal_signature")) || !bytes.Contains(public, []byte(`"phone":"+9*******00"`)) {
+		t.Errorf("unexpected public representation: %s", public)
+	}
+}
+
+func TestTransformer_Fingerprint(t *testing.T) {
+	fingerprint := func(reg *Registry, drop, mask []string) string {
+		t.Helper()
+		tr, err := NewTransformer(reg, drop, mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr.Fingerprint()
+	}
+
+	base := fingerprint(NewRegistry(), []string{"internal_signature"}, []string{"delivery.phone"})
+	if fp := fingerprint(NewRegistry(), []string{"internal_signature"}, []string{"delivery.phone"}); fp != base {
+		t.Error("fingerprint is not stable")
+	}
+
+	v2 := NewRegistry()
+	if err := v2.Register("2", withComment(t)); err != nil {
+		t.Fatal(err)
+	}
+	for name, fp := range map[string]string{
+		"drop":   fingerprint(NewRegistry(), nil, []string{"delivery.phone"}),
+		"mask":   fingerprint(NewRegistry(), []string{"internal_signature"}, []string{"delivery.email"}),
+		"schema": fingerprint(v2, []string{"internal_signature"}, []string{"delivery.phone"}),
+	} {
+		if fp == base {
+			t.Errorf("fingerprint does not change with %s", name)
+		}
+	}
+}
+
+func TestNewTransformer_UnknownField(t *testing.T) {
+	if _, err := NewTransformer(NewRegistry(), []string{"delivery.fax"}, nil); err == nil {
+		t.Error("expected error for unknown drop field")
+	}
+	if _, err := NewTransformer(NewRegistry(), nil, []string{"payment.amount"}); err == nil {
+		t.Error("expected error for masking a number")
+	}
+}
@@ -0,0 +1,270 @@
+package receiver
+
+import (
+	"sync"
+	"time"
+
+	"0lvl/config"
+)
+
+// BackpressureStats — состояние контроллера и глубина очередей.
+type BackpressureStats struct {
+	// Paused — прием остановлен вручную или по задержке базы.
+	Paused    bool         `json:"paused"`
+	Manual    bool         `json:"manual"`
+	Auto      bool         `json:"auto"`
+	Pauses    uint64       `json:"pauses"`
+	LatencyMs float64      `json:"latency_ms"`
+	PauseMs   int64        `json:"pause_latency_ms"`
+	ResumeMs  int64        `json:"resume_latency_ms"`
+	RateLimit float64      `json:"rate_limit"`
+	RateBurst int          `json:"rate_burst"`
+	Throttled uint64       `json:"throttled"`
+	Queues    []QueueStats `json:"queues"`
+}
+
+// QueueStats — очередь между подписчиком и накопителями.
+type QueueStats struct {
+	Subject  string `json:"subject"`
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+}
+
+// backpressure решает, когда подписчику брать следующее сообщение.
+//
+// Пока подписчик ждет, он не возвращается из обратного вызова,
+// и брокер перестает присылать сообщения, набрав MaxInflight
+// неподтвержденных. Подписчик ждет:
+//   - места в очереди к накопителям (QueueSize);
+//   - токена своего ограничителя (RateLimit, RateBurst);
+//   - снятия паузы: ручной через Pause/Resume или автоматической,
+//     когда задержка сохранения выше PauseLatency.
+//
+// Автоматическая пауза снимается, когда задержка опустилась
+// до ResumeLatency, или через PauseCooldown: пока прием стоит,
+// новых пакетов и замеров может не быть.
+//
+// Пауза держит только обратный вызов, подписка у брокера остается:
+// он присылает сообщения, пока не наберет MaxInflight неподтвержденных,
+// и AckWait у них идет. Пауза дольше AckWait — и брокер пришлет их
+// снова, повторы отсеет SaveOrderBatch как дубликаты.
+type backpressure struct {
+	rate  float64
+	burst int
+
+	pauseAt, resumeAt time.Duration
+	cooldown          time.Duration
+
+	mu        sync.Mutex
+	manual    bool
+	auto      bool
+	resumed   chan struct{} // закрыт, пока паузы нет
+	latency   float64       // мс
+	pauses    uint64
+	throttled uint64
+	cooling   *time.Timer
+	// Номер автоматической паузы: cool от прошлой паузы,
+	// таймер которой уже сработал, новую не снимает.
+	cycle uint64
+}
+
+func newBackpressure(cfg config.Config) *backpressure {
+	bp := &backpressure{
+		rate:     cfg.RateLimit,
+		burst:    cfg.RateBurst,
+		pauseAt:  cfg.PauseLatency,
+		resumeAt: cfg.ResumeLatency,
+		cooldown: cfg.PauseCooldown,
+		resumed:  make(chan struct{}),
+	}
+	if bp.resumeAt == 0 {
+		bp.resumeAt = bp.pauseAt / 2
+	}
+	if bp.burst < 1 {
+		bp.burst = 1
+	}
+	close(bp.resumed)
+	return bp
+}
+
+// wait ждет снятия паузы, false — stop закрылся раньше.
+func (bp *backpressure) wait(stop <-chan struct{}) bool {
+	bp.mu.Lock()
+	resumed := bp.resumed
+	bp.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Pause останавливает прием до Resume.
+func (r *Receiver) Pause() {
+	bp := r.bp
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.manual = true
+	bp.update()
+}
+
+// Resume снимает ручную паузу,
+// автоматическая остается, пока база не разгрузится.
+func (r *Receiver) Resume() {
+	bp := r.bp
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.manual = false
+	bp.update()
+}
+
+// observe учитывает задержку сохранения пакета.
+func (bp *backpressure) observe(latency time.Duration) {
+	if bp.pauseAt <= 0 {
+		return
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.latency = ewma(bp.latency, float64(latency)/float64(time.Millisecond))
+	avg := time.Duration(bp.latency * float64(time.Millisecond))
+
+	switch {
+	case !bp.auto && avg > bp.pauseAt:
+		bp.auto = true
+		bp.cycle++
+		cycle := bp.cycle
+		bp.cooling = time.AfterFunc(bp.cooldown, func() { bp.cool(cycle) })
+		bp.update()
+	case bp.auto && avg <= bp.resumeAt:
+		bp.cooling.Stop()
+		bp.auto = false
+		bp.update()
+	}
+}
+
+// cool снимает автоматическую паузу cycle по PauseCooldown,
+// задержка считается заново. Паузу, снятую раньше, и следующую
+// за ней не трогает.
+func (bp *backpressure) cool(cycle uint64) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if !bp.auto || cycle != bp.cycle {
+		return
+	}
+	bp.auto = false
+	bp.latency = 0
+	bp.update()
+}
+
+// update открывает или закрывает resumed по manual и auto.
+func (bp *backpressure) update() {
+	paused := bp.manual || bp.auto
+	select {
+	case <-bp.resumed:
+		if paused {
+			bp.resumed = make(chan struct{})
+			bp.pauses++
+		}
+	default:
+		if !paused {
+			close(bp.resumed)
+		}
+	}
+}
+
+func (bp *backpressure) stats() BackpressureStats {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return BackpressureStats{
+		Paused:    bp.manual || bp.auto,
+		Manual:    bp.manual,
+		Auto:      bp.auto,
+		Pauses:    bp.pauses,
+		LatencyMs: bp.latency,
+		PauseMs:   bp.pauseAt.Milliseconds(),
+		ResumeMs:  bp.resumeAt.Milliseconds(),
+		RateLimit: bp.rate,
+		RateBurst: bp.burst,
+		Throttled: bp.throttled,
+	}
+}
+
+// limiter — token bucket одного подписчика, nil — без ограничения.
+func (bp *backpressure) limiter() *bucket {
+	if bp.rate <= 0 {
+		return nil
+	}
+	return &bucket{bp: bp, rate: bp.rate, burst: float64(bp.burst), tokens: float64(bp.burst), last: time.Now()}
+}
+
+// bucket делят обратные вызовы подписчика,
+// источник может вызывать их одновременно.
+type bucket struct {
+	bp    *backpressure
+	rate  float64
+	burst float64
+
+	mu sync.Mutex
+	// tokens меньше нуля — токены, уже обещанные ждущим вызовам.
+	tokens float64
+	last   time.Time
+}
+
+// take забирает токен, ожидая его при необходимости,
+// false — stop закрылся раньше.
+func (b *bucket) take(stop <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = minOf(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	debt := -b.tokens
+	b.mu.Unlock()
+	if debt <= 0 {
+		return true
+	}
+
+	b.bp.mu.Lock()
+	b.bp.throttled++
+	b.bp.mu.Unlock()
+
+	wait := time.NewTimer(time.Duration(debt / b.rate * float64(time.Second)))
+	defer wait.Stop()
+	select {
+	case <-wait.C:
+		return true
+	case <-stop:
+		// Токен не понадобился, возвращаем.
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return false
+	}
+}
+
+// Backpressure возвращает состояние контроллера и глубину очередей.
+func (r *Receiver) Backpressure() BackpressureStats {
+	st := r.bp.stats()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen == nil {
+		return st
+	}
+	for _, q := range r.gen.queues {
+		for _, ch := range q.chs {
+			st.Queues = append(st.Queues, QueueStats{
+				Subject:  q.subject,
+				Depth:    len(ch),
+				Capacity: cap(ch),
+			})
+		}
+	}
+	return st
+}
@@ -0,0 +1,92 @@
+package receiver
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"0lvl/config"
+)
+
+// Обратные вызовы одного подписчика берут токены одновременно,
+// запускать с -race.
+func TestBucket_Concurrent(t *testing.T) {
+	const (
+		rate     = 1000
+		burst    = 10
+		handlers = 8
+		takes    = 20
+	)
+	bp := newBackpressure(config.Config{RateLimit: rate, RateBurst: burst})
+	b := bp.limiter()
+	stop := make(chan struct{})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < handlers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < takes; j++ {
+				if !b.take(stop) {
+					t.Error("take stopped")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Сверх burst токены выдаются не чаще rate в секунду.
+	want := time.Duration(handlers*takes-burst) * time.Second / rate
+	if elapsed := time.Since(start); elapsed < want*9/10 {
+		t.Errorf("took %d tokens in %s, want at least %s", handlers*takes, elapsed, want)
+	}
+	if st := bp.stats(); st.Throttled == 0 {
+		t.Error("no handler was throttled")
+	}
+}
+
+func TestBucket_Stop(t *testing.T) {
+	bp := newBackpressure(config.Config{RateLimit: 1, RateBurst: 1})
+	b := bp.limiter()
+	stop := make(chan struct{})
+
+	if !b.take(stop) {
+		t.Fatal("first token must be free")
+	}
+	close(stop)
+	if b.take(stop) {
+		t.Fatal("take must stop without a token")
+	}
+	// Обещанный токен вернулся: долг не копится.
+	if b.tokens < -0.5 {
+		t.Errorf("got %f tokens after stop", b.tokens)
+	}
+}
+
+// Таймер первой паузы сработал, когда ее уже сняли по задержке:
+// запоздалый cool не снимает следующую паузу.
+func TestBackpressure_StaleCool(t *testing.T) {
+	bp := newBackpressure(config.Config{PauseLatency: 100 * time.Millisecond, PauseCooldown: time.Hour})
+	slow, fast := time.Second, time.Duration(0)
+
+	bp.observe(slow)
+	first := bp.cycle
+	for bp.stats().Auto {
+		bp.observe(fast)
+	}
+	bp.observe(slow)
+	if !bp.stats().Auto {
+		t.Fatal("second pause did not start")
+	}
+
+	bp.cool(first)
+	if !bp.stats().Auto {
+		t.Error("stale cooldown resumed the second pause")
+	}
+	bp.cool(bp.cycle)
+	if bp.stats().Paused {
+		t.Error("cooldown did not resume the pause")
+	}
+}
@@ -0,0 +1,151 @@
+package receiver
+
+import (
+	"sync"
+	"time"
+
+	"0lvl/config"
+)
+
+// Режимы подбора пакета, см. config.BatchMode.
+const (
+	BatchFixed    = "fixed"
+	BatchAdaptive = "adaptive"
+)
+
+const (
+	// На сколько растет пакет, если база укладывается в цель.
+	batchStep = 16
+	// Вес нового наблюдения в скользящих средних.
+	ewmaWeight = 0.2
+)
+
+// BatchStats — текущие параметры накопителя.
+type BatchStats struct {
+	Subject    string  `json:"subject"`
+	Mode       string  `json:"mode"`
+	Size       int     `json:"size"`
+	DeadlineMs int64   `json:"deadline_ms"`
+	LatencyMs  float64 `json:"latency_ms"`
+	Rate       float64 `json:"rate"`
+	Flushes    uint64  `json:"flushes"`
+	Orders     uint64  `json:"orders"`
+}
+
+// tuner подбирает размер пакета и дедлайн одного накопителя.
+//
+// Размер — AIMD по задержке сохранения: пока пакет заполняется
+// и база укладывается в BatchLatencyTarget, размер растет на batchStep,
+// как только не укладывается — уменьшается вдвое.
+//
+// Дедлайн — время, за которое при текущем входящем потоке
+// набирается полный пакет, в пределах от BatchMinDeadline до BatchDeadline.
+// При низком трафике заказ ждет не дольше BatchDeadline,
+// при высоком пакеты уходят по размеру.
+//
+// В режиме fixed размер и дедлайн не меняются.
+type tuner struct {
+	mu sync.Mutex
+
+	adaptive bool
+	target   time.Duration
+
+	size, minSize, maxSize             int
+	deadline, minDeadline, maxDeadline time.Duration
+
+	latency float64 // мс
+	rate    float64 // заказов в секунду
+	last    time.Time
+
+	stats BatchStats
+}
+
+func newTuner(cfg config.Config, subject string, size int, deadline time.Duration) *tuner {
+	t := &tuner{
+		adaptive:    cfg.BatchMode == BatchAdaptive,
+		target:      cfg.BatchLatencyTarget,
+		size:        size,
+		minSize:     minOf(cfg.BatchMinSize, size),
+		maxSize:     cfg.BatchMaxSize,
+		deadline:    deadline,
+		minDeadline: minOf(cfg.BatchMinDeadline, deadline),
+		maxDeadline: cfg.BatchDeadline,
+		last:        time.Now(),
+	}
+	t.stats.Subject = subject
+	t.stats.Mode = cfg.BatchMode
+	return t
+}
+
+// params возвращает размер пакета и дедлайн для следующего пакета.
+func (t *tuner) params() (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.size, t.deadline
+}
+
+// observe учитывает слитый пакет: n заказов, latency — время сохранения.
+func (t *tuner) observe(n int, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(t.last)
+	t.last = now
+
+	t.latency = ewma(t.latency, float64(latency)/float64(time.Millisecond))
+	if elapsed > 0 {
+		t.rate = ewma(t.rate, float64(n)/elapsed.Seconds())
+	}
+	t.stats.Flushes++
+	t.stats.Orders += uint64(n)
+
+	if t.adaptive {
+		switch {
+		case latency > t.target:
+			t.size = maxOf(t.minSize, t.size/2)
+		case n >= t.size:
+			t.size = minOf(t.maxSize, t.size+batchStep)
+		}
+
+		t.deadline = t.maxDeadline
+		if t.rate > 0 {
+			fill := time.Duration(float64(t.size) / t.rate * float64(time.Second))
+			t.deadline = minOf(t.maxDeadline, maxOf(t.minDeadline, fill))
+		}
+	}
+}
+
+func (t *tuner) snapshot() BatchStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := t.stats
+	st.Size = t.size
+	st.DeadlineMs = t.deadline.Milliseconds()
+	st.LatencyMs = t.latency
+	st.Rate = t.rate
+	return st
+}
+
+func ewma(avg, v float64) float64 {
+	if avg == 0 {
+		return v
+	}
+	return avg + ewmaWeight*(v-avg)
+}
+
+// minOf и maxOf — min и max, которых нет среди встроенных до Go 1.21.
+func minOf[T int | float64 | time.Duration](a, b T) T {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxOf[T int | float64 | time.Duration](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,86 @@
+package receiver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTuner_Fixed(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BatchMode = BatchFixed
+	tn := newTuner(cfg, "order", 64, 50*time.Millisecond)
+
+	tn.observe(64, time.Second)
+	tn.observe(1, time.Millisecond)
+	if size, deadline := tn.params(); size != 64 || deadline != 50*time.Millisecond {
+		t.Errorf("fixed tuner changed params: %d %s", size, deadline)
+	}
+	if st := tn.snapshot(); st.Flushes != 2 || st.Orders != 65 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestTuner_AdaptiveSize(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BatchMode = BatchAdaptive
+	cfg.BatchMinSize = 16
+	cfg.BatchMaxSize = 80
+	cfg.BatchLatencyTarget = 100 * time.Millisecond
+	tn := newTuner(cfg, "order", 64, cfg.BatchDeadline)
+
+	steps := []struct {
+		name    string
+		n       int
+		latency time.Duration
+		size    int
+	}{
+		// Полный пакет в пределах цели — растет на batchStep, но не выше max.
+		{"grow", 64, 10 * time.Millisecond, 64 + batchStep},
+		{"max", 80, 10 * time.Millisecond, 80},
+		// Неполный пакет в пределах цели — не меняется.
+		{"partial", 10, 10 * time.Millisecond, 80},
+		// База не укладывается в цель — вдвое, но не ниже min.
+		{"slow", 80, 200 * time.Millisecond, 40},
+		{"slower", 40, 200 * time.Millisecond, 20},
+		{"min", 20, 200 * time.Millisecond, 16},
+	}
+	for _, st := range steps {
+		tn.observe(st.n, st.latency)
+		if size, _ := tn.params(); size != st.size {
+			t.Fatalf("%s: got size %d, want %d", st.name, size, st.size)
+		}
+	}
+}
+
+func TestTuner_AdaptiveDeadline(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BatchMode = BatchAdaptive
+	cfg.BatchDeadline = time.Second
+	cfg.BatchMinDeadline = 10 * time.Millisecond
+	cfg.BatchLatencyTarget = time.Hour
+	tn := newTuner(cfg, "order", 64, cfg.BatchDeadline)
+
+	// 32 заказа в секунду: пакет из 64 набирается за 2с, дедлайн — max.
+	tn.last = time.Now().Add(-time.Second)
+	tn.observe(32, time.Millisecond)
+	if _, deadline := tn.params(); deadline != time.Second {
+		t.Errorf("slow inbound: got deadline %s, want 1s", deadline)
+	}
+
+	// Поток за миг: дедлайн не ниже min.
+	tn = newTuner(cfg, "order", 64, cfg.BatchDeadline)
+	tn.last = time.Now().Add(-time.Microsecond)
+	tn.observe(10000, time.Millisecond)
+	if _, deadline := tn.params(); deadline != 10*time.Millisecond {
+		t.Errorf("fast inbound: got deadline %s, want 10ms", deadline)
+	}
+
+	// Между пределами: 1000 в секунду, пакет 64+16 набирается за 80мс.
+	tn = newTuner(cfg, "order", 64, cfg.BatchDeadline)
+	tn.last = time.Now().Add(-time.Second)
+	tn.observe(1000, time.Millisecond)
+	size, deadline := tn.params()
+	if want := time.Duration(float64(size) / 1000 * float64(time.Second)); deadline < want || deadline > want*11/10 {
+		t.Errorf("got deadline %s, want about %s", deadline, want)
+	}
+}
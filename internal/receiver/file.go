@@ -0,0 +1,128 @@
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"0lvl/internal/inspector"
+
+	"github.com/rs/zerolog"
+)
+
+// Предел длины строки файла, длиннее — ошибка чтения.
+const maxFileLine = 16 * 1024 * 1024
+
+// FileSource читает заказы из файла NDJSON для дозагрузки истории:
+// по заказу в строке, все уходят в тему subject.
+// Файл читается при первой подписке на subject, Nak возвращает строку в очередь.
+// Когда все строки обработаны, итог пишется в лог и закрывается Finished.
+type FileSource struct {
+	*queue
+
+	path    string
+	subject string
+	log     zerolog.Logger
+
+	start    sync.Once
+	pending  sync.WaitGroup
+	finished chan struct{}
+
+	lines  atomic.Uint64
+	acked  atomic.Uint64
+	naked  atomic.Uint64
+	termed atomic.Uint64
+}
+
+func NewFileSource(path, subject string, log zerolog.Logger) (*FileSource, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	s := &FileSource{
+		path:     path,
+		subject:  subject,
+		log:      log,
+		finished: make(chan struct{}),
+	}
+	s.queue = newQueue(SourceFile, s.settle)
+	return s, nil
+}
+
+func (s *FileSource) Subscribe(subject string, opt SubOptions, handler func(inspector.Message)) (Subscription, error) {
+	sub, err := s.queue.Subscribe(subject, opt, handler)
+	if err == nil && subject == s.subject {
+		s.start.Do(func() {
+			go s.read()
+		})
+	}
+	return sub, err
+}
+
+// Finished закрывается, когда все строки файла обработаны.
+func (s *FileSource) Finished() <-chan struct{} {
+	return s.finished
+}
+
+// Stats — сколько строк прочитано, подтверждено, возвращено в очередь и отброшено.
+func (s *FileSource) Stats() (lines, acked, naked, termed uint64) {
+	return s.lines.Load(), s.acked.Load(), s.naked.Load(), s.termed.Load()
+}
+
+func (s *FileSource) read() {
+	defer close(s.finished)
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		s.log.Error().Err(err).Str("file", s.path).Msg("file source error")
+		return
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxFileLine)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		s.lines.Add(1)
+		s.pending.Add(1)
+		if _, err := s.push(context.Background(), s.subject, append([]byte(nil), line...)); err != nil {
+			s.pending.Done()
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		s.log.Error().Err(err).Str("file", s.path).Msg("file source error")
+	}
+
+	s.pending.Wait()
+	lines, acked, naked, termed := s.Stats()
+	s.log.Info().Str("file", s.path).
+		Uint64("lines", lines).
+		Uint64("acked", acked).
+		Uint64("naked", naked).
+		Uint64("termed", termed).
+		Msg("file source done")
+}
+
+func (s *FileSource) settle(m *queueMsg, o outcome) {
+	switch o {
+	case outcomeAck:
+		s.acked.Add(1)
+		s.pending.Done()
+	case outcomeTerm:
+		s.termed.Add(1)
+		s.pending.Done()
+	case outcomeNak:
+		s.naked.Add(1)
+		go func() {
+			if s.requeue(context.Background(), m) != nil {
+				s.pending.Done()
+			}
+		}()
+	}
+}
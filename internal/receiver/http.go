@@ -0,0 +1,224 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"0lvl/internal/inspector"
+	"0lvl/internal/repository"
+)
+
+const (
+	// Предел тела запроса HTTPSource.
+	maxPushBytes = 1024 * 1024
+	// Сколько заказ ждет места в очереди темы, потом итог — retry.
+	pushQueueWait = time.Second
+)
+
+// Итоги заказа, принятого по HTTP, см. PushResult.Status.
+const (
+	PushAccepted  = "accepted"
+	PushDuplicate = "duplicate"
+	PushRejected  = "rejected"
+	PushRetry     = "retry"
+)
+
+var msgUnknownSubject = []byte(`{"message": "Unknown subject"}`)
+
+// PushResult — итог одного заказа, принятого по HTTP.
+// Errors — ошибки проверки, если заказ отвергнут инспектором.
+type PushResult struct {
+	Line   int                          `json:"line,omitempty"`
+	Uid    string                       `json:"order_uid,omitempty"`
+	Status string                       `json:"status"`
+	Error  string                       `json:"error,omitempty"`
+	Errors []*inspector.ValidationError `json:"errors,omitempty"`
+}
+
+// HTTPStatus — код ответа на один заказ:
+// 200 — заказ сохранен, 422 — отвергнут и лежит в rejected_order,
+// 503 — не сохранен, стоит повторить позже.
+func (res PushResult) HTTPStatus() int {
+	switch res.Status {
+	case PushAccepted, PushDuplicate:
+		return http.StatusOK
+	case PushRejected:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusServiceUnavailable
+}
+
+// HTTPSource принимает заказы по HTTP для тех, у кого нет доступа к NATS.
+// Заказы проходят ту же проверку и те же накопители, что и из NATS,
+// ответ ждет итога обработки.
+//
+// Как http.Handler: тело — заказ, путь — тема, как в NATS:
+// order, order.2, order.msgpack. Content-Type, если он задан,
+// главнее формата из темы.
+type HTTPSource struct {
+	*queue
+
+	// Тема для Push без темы.
+	subject string
+}
+
+func NewHTTPSource(subject string) *HTTPSource {
+	s := &HTTPSource{subject: subject}
+	s.queue = newQueue(SourceHTTP, s.settle)
+	return s
+}
+
+var errUnknownSubject = errors.New("unknown subject")
+
+// Push отправляет заказ в тему subject, пусто — основная тема,
+// и ждет итога или ctx. Формат заказа — contentType, если он понятен
+// ParseEncoding, иначе формат темы.
+func (s *HTTPSource) Push(ctx context.Context, subject, contentType string, data []byte) PushResult {
+	res := s.PushBatch(ctx, subject, contentType, [][]byte{data})
+	res[0].Line = 0
+	return res[0]
+}
+
+// PushBatch отправляет заказы в тему subject все сразу,
+// чтобы они попали в одни пакеты, и ждет итога каждого.
+// Line в итогах — номер заказа с единицы.
+func (s *HTTPSource) PushBatch(ctx context.Context, subject, contentType string, orders [][]byte) []PushResult {
+	if subject == "" {
+		subject = s.subject
+	}
+	res := make([]PushResult, len(orders))
+	msgs := make([]*queueMsg, len(orders))
+
+	var err error
+	if !s.subscribed(subject) {
+		err = errUnknownSubject
+	}
+	for i, data := range orders {
+		res[i] = PushResult{Line: i + 1, Status: PushRetry}
+		// Очередь полна или источник закрыт: остальные заказы не ставим.
+		if err == nil {
+			msgs[i], err = s.pushWait(ctx, subject, contentType, data)
+		}
+		if err != nil {
+			res[i].Error = err.Error()
+		}
+	}
+
+	for i, m := range msgs {
+		if m == nil {
+			continue
+		}
+		select {
+		case o := <-m.result:
+			res[i] = m.pushResult(i+1, o)
+		case <-ctx.Done():
+			// Клиент ушел, заказы все равно будут обработаны.
+			return res
+		case <-s.done:
+			// Все, что было в очереди, Close вернул с итогом,
+			// итога нет только у того, что встало в очередь после.
+			select {
+			case o := <-m.result:
+				res[i] = m.pushResult(i+1, o)
+			default:
+				res[i].Error = errSourceClosed.Error()
+			}
+		}
+	}
+	return res
+}
+
+var errQueueFull = errors.New("queue is full")
+
+// pushWait ставит заказ в очередь, ожидая места не дольше pushQueueWait.
+func (s *HTTPSource) pushWait(ctx context.Context, subject, contentType string, data []byte) (*queueMsg, error) {
+	ctx, cancel := context.WithTimeout(ctx, pushQueueWait)
+	defer cancel()
+
+	m := s.newMsg(subject, data)
+	m.contentType = contentType
+	err := s.requeue(ctx, m)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errQueueFull
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *HTTPSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	subject := strings.Trim(r.URL.Path, "/")
+	if !s.subscribed(subject) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(msgUnknownSubject)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	res := s.Push(r.Context(), subject, r.Header.Get("Content-Type"), body)
+	b, _ := json.Marshal(res)
+	w.WriteHeader(res.HTTPStatus())
+	w.Write(b)
+}
+
+func (s *HTTPSource) settle(m *queueMsg, o outcome) {
+	select {
+	case m.result <- o:
+	default:
+	}
+}
+
+// reporter — сообщение, источнику которого нужен итог заказа,
+// а не только Ack или Term. report вызывается до Ack и Term.
+type reporter interface {
+	report(uid string, err error)
+}
+
+// report передает итог заказа источнику, если он его ждет.
+func report(box *inspector.OrderBox) {
+	if rp, ok := box.Msg.(reporter); ok {
+		rp.report(box.Uid, box.Err)
+	}
+}
+
+func (m *queueMsg) report(uid string, err error) {
+	m.uid = uid
+	m.err = err
+}
+
+// pushResult собирает итог после получения o из result,
+// поля uid и err к этому времени уже записаны.
+func (m *queueMsg) pushResult(line int, o outcome) PushResult {
+	res := PushResult{Line: line, Uid: m.uid}
+	switch {
+	case o == outcomeAck && errors.Is(m.err, repository.ErrDuplicate):
+		res.Status = PushDuplicate
+	case o == outcomeAck:
+		res.Status = PushAccepted
+	case o == outcomeTerm:
+		res.Status = PushRejected
+	default:
+		res.Status = PushRetry
+	}
+	if o != outcomeAck && m.err != nil {
+		res.Error = m.err.Error()
+		res.Errors = inspector.Errors(m.err)
+	}
+	return res
+}
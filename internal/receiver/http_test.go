@@ -0,0 +1,136 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"0lvl/internal/inspector"
+)
+
+// Очередь полна, у запроса нет дедлайна: заказ ждет места
+// не дольше pushQueueWait и получает 503 и retry.
+func TestHTTPSource_FullQueue(t *testing.T) {
+	src := NewHTTPSource("order")
+	defer src.Close()
+
+	// Подписчик взял первое сообщение и завис, остальные копятся в очереди.
+	taken := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	if _, err := src.Subscribe("order", SubOptions{}, func(inspector.Message) {
+		select {
+		case taken <- struct{}{}:
+		default:
+		}
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.push(context.Background(), "order", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	<-taken
+	for i := 0; i < defaultQueueSize; i++ {
+		if _, err := src.push(context.Background(), "order", []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	src.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/order", strings.NewReader("{}")))
+	if elapsed := time.Since(start); elapsed > pushQueueWait+time.Second {
+		t.Errorf("push to full queue took %s", elapsed)
+	}
+
+	var res PushResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || res.Status != PushRetry || res.Error != errQueueFull.Error() {
+		t.Errorf("got %d %+v, want %d retry %q", w.Code, res, http.StatusServiceUnavailable, errQueueFull)
+	}
+}
+
+// Остановка во время сохранения: ресивер дожидается накопителя,
+// заказ сохраняется, ответ — accepted, а не обрыв.
+func TestHTTPSource_ShutdownInflight(t *testing.T) {
+	cfg := testConfig(t)
+	store := newRecordStore()
+	gate := make(chan struct{})
+	store.gate = gate
+	src := NewHTTPSource(cfg.StanSubject)
+	rec, repo := startReceiver(t, cfg, store, src)
+
+	uid := "http0000000000000001"
+	pushed := make(chan PushResult, 1)
+	go func() {
+		pushed <- src.Push(context.Background(), "", "", []byte(testOrder(uid, "alice")))
+	}()
+	<-store.blocked
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- rec.Shutdown(ctx)
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("shutdown did not wait for the in-flight push: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(gate)
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if res := <-pushed; res.Status != PushAccepted || res.Uid != uid {
+		t.Errorf("got %+v, want %s accepted", res, uid)
+	}
+	if _, err := repo.Order(uid); err != nil {
+		t.Errorf("order is not saved: %v", err)
+	}
+
+	// После остановки заказы не принимаются, клиент повторит позже.
+	if res := src.Push(context.Background(), "", "", []byte(testOrder(uid, "alice"))); res.HTTPStatus() != http.StatusServiceUnavailable {
+		t.Errorf("push after shutdown: %+v", res)
+	}
+}
+
+// Content-Type главнее формата темы: JSON, присланный как CBOR,
+// не разбирается, а незнакомый тип не мешает разобрать JSON.
+func TestHTTPSource_ContentType(t *testing.T) {
+	cfg := testConfig(t)
+	src := NewHTTPSource(cfg.StanSubject)
+	rec, _ := startReceiver(t, cfg, newRecordStore(), src)
+	defer rec.Shutdown(context.Background())
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"", http.StatusOK},
+		{"application/json", http.StatusOK},
+		{"application/x-www-form-urlencoded", http.StatusOK},
+		{"application/cbor", http.StatusUnprocessableEntity},
+	}
+	for i, tt := range tests {
+		uid := fmt.Sprintf("http%016d", i+1)
+		r := httptest.NewRequest(http.MethodPost, "/"+cfg.StanSubject, strings.NewReader(testOrder(uid, "alice")))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		src.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Content-Type %q: got %d %s, want %d", tt.contentType, w.Code, w.Body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Сколько ждать ответа JetStream API при создании потока и консьюмеров.
+	jetStreamTimeout = 10 * time.Second
+	// Сколько сообщений запрашивать за раз при Replay.
+	replayFetch = 256
+)
+
+// JetStreamSource читает заказы из durable pull консьюмеров JetStream.
+type JetStreamSource struct {
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	stream string
+	log    zerolog.Logger
+}
+
+// NewJetStreamSource подключается к NATS и создает поток,
+// если его еще нет: тема StanSubject и все ее суффиксы.
+func NewJetStreamSource(cfg config.Config, log zerolog.Logger) (*JetStreamSource, error) {
+	nc, err := nats.Connect(cfg.NatsUrl, nats.Name(cfg.StanClientId))
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jetStreamTimeout)
+	defer cancel()
+
+	_, err = js.Stream(ctx, cfg.JetStreamStream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.JetStreamStream,
+			Subjects: []string{cfg.StanSubject, cfg.StanSubject + ".>"},
+		})
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	t := &JetStreamSource{
+		nc:     nc,
+		js:     js,
+		stream: cfg.JetStreamStream,
+		log:    log,
+	}
+	return t, nil
+}
+
+func (t *JetStreamSource) Name() string {
+	return SourceJetStream
+}
+
+// Subscribe создает durable pull консьюмер на тему.
+// Все подписчики с одним durable делят сообщения между собой,
+// как queue group в stan. Новые AckWait и MaxInflight
+// обновляют существующий консьюмер.
+func (t *JetStreamSource) Subscribe(subject string, opt SubOptions, handler func(inspector.Message)) (Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jetStreamTimeout)
+	defer cancel()
+
+	cons, err := t.js.CreateOrUpdateConsumer(ctx, t.stream, jetstream.ConsumerConfig{
+		Durable:       consumerName(opt.Durable),
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       opt.AckWait,
+		MaxAckPending: opt.MaxInflight,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cc, err := cons.Consume(
+		func(m jetstream.Msg) {
+			handler(jetMsg{m})
+		},
+		jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			t.log.Error().Err(err).Str("subject", subject).Msg("jetstream consume error")
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return jetSubscription{cc}, nil
+}
+
+// Replay читает историю темы эфемерным упорядоченным консьюмером.
+// История кончилась, когда за ним не осталось сообщений в потоке.
+func (t *JetStreamSource) Replay(ctx context.Context, subject string, rng ReplayRange, handler func(inspector.Message)) error {
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{subject},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	}
+	switch {
+	case rng.SinceSeq > 0:
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = rng.SinceSeq
+	case !rng.SinceTime.IsZero():
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &rng.SinceTime
+	}
+
+	cons, err := t.js.OrderedConsumer(ctx, t.stream, cfg)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := cons.Fetch(replayFetch, jetstream.FetchMaxWait(rng.idle()))
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for m := range batch.Messages() {
+			n++
+			meta, err := m.Metadata()
+			if err != nil {
+				return err
+			}
+			if rng.past(meta.Sequence.Stream, meta.Timestamp) {
+				return nil
+			}
+			handler(jetMsg{m})
+			if meta.NumPending == 0 {
+				return nil
+			}
+		}
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+func (t *JetStreamSource) Publish(subject string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), jetStreamTimeout)
+	defer cancel()
+
+	_, err := t.js.Publish(ctx, subject, data)
+	return err
+}
+
+func (t *JetStreamSource) Close() error {
+	t.nc.Close()
+	return nil
+}
+
+// consumerName приводит имя durable из stan к допустимому в JetStream:
+// все, кроме латинских букв, цифр, _ и -, заменяется на -.
+func consumerName(durable string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, durable)
+}
+
+type jetSubscription struct {
+	cc jetstream.ConsumeContext
+}
+
+func (s jetSubscription) Close() error {
+	s.cc.Stop()
+	return nil
+}
+
+type jetMsg struct {
+	m jetstream.Msg
+}
+
+func (m jetMsg) Data() []byte      { return m.m.Data() }
+func (m jetMsg) Subject() string   { return m.m.Subject() }
+func (m jetMsg) Source() string    { return SourceJetStream }
+func (m jetMsg) Ack() error        { return m.m.Ack() }
+func (m jetMsg) Nak() error        { return m.m.Nak() }
+func (m jetMsg) Term() error       { return m.m.Term() }
+func (m jetMsg) InProgress() error { return m.m.InProgress() }
+
+func (m jetMsg) ContentType() string {
+	return m.m.Headers().Get("Content-Type")
+}
+
+func (m jetMsg) Timestamp() time.Time {
+	meta, err := m.m.Metadata()
+	if err != nil {
+		return time.Now()
+	}
+	return meta.Timestamp
+}
@@ -0,0 +1,18 @@
+package receiver
+
+import "testing"
+
+func TestConsumerName(t *testing.T) {
+	tests := map[string]string{
+		"service orders":      "service-orders",
+		"service orders 2":    "service-orders-2",
+		"orders.msgpack":      "orders-msgpack",
+		"orders/*>\tкопия_v2": "orders---------_v2",
+		"Orders_1-a":          "Orders_1-a",
+	}
+	for durable, want := range tests {
+		if got := consumerName(durable); got != want {
+			t.Errorf("consumerName(%q) = %q, want %q", durable, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package receiver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"0lvl/internal/inspector"
+)
+
+// MemorySource — источник в памяти для тестов и локального запуска.
+// Заказы кладутся через Publish, Nak возвращает сообщение в очередь.
+// Все опубликованное остается в истории для Replay.
+type MemorySource struct {
+	*queue
+
+	mu      sync.Mutex
+	history []memoryRecord
+
+	acked  atomic.Uint64
+	naked  atomic.Uint64
+	termed atomic.Uint64
+}
+
+func NewMemorySource() *MemorySource {
+	s := &MemorySource{}
+	s.queue = newQueue(SourceMemory, s.settle)
+	return s
+}
+
+// memoryRecord — сообщение в истории MemorySource.
+type memoryRecord struct {
+	subject string
+	data    []byte
+	ts      time.Time
+}
+
+// Publish ставит заказ в очередь темы.
+func (s *MemorySource) Publish(subject string, data []byte) error {
+	m, err := s.push(context.Background(), subject, data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.history = append(s.history, memoryRecord{subject: subject, data: data, ts: m.ts})
+	s.mu.Unlock()
+	return nil
+}
+
+// Replay перечитывает историю темы, номер сообщения — его место
+// в истории всех тем с 1, как в потоке JetStream.
+// Idle не нужен: история известна целиком.
+func (s *MemorySource) Replay(ctx context.Context, subject string, rng ReplayRange, handler func(inspector.Message)) error {
+	s.mu.Lock()
+	history := s.history[:len(s.history):len(s.history)]
+	s.mu.Unlock()
+
+	for i, rec := range history {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		seq := uint64(i + 1)
+		if rec.subject != subject || rng.before(seq, rec.ts) {
+			continue
+		}
+		if rng.past(seq, rec.ts) {
+			return nil
+		}
+		handler(&queueMsg{
+			q:       s.queue,
+			subject: rec.subject,
+			data:    rec.data,
+			ts:      rec.ts,
+			result:  make(chan outcome, 1),
+		})
+	}
+	return nil
+}
+
+// Stats — сколько сообщений подтверждено, возвращено в очередь и отброшено.
+func (s *MemorySource) Stats() (acked, naked, termed uint64) {
+	return s.acked.Load(), s.naked.Load(), s.termed.Load()
+}
+
+func (s *MemorySource) settle(m *queueMsg, o outcome) {
+	switch o {
+	case outcomeAck:
+		s.acked.Add(1)
+	case outcomeTerm:
+		s.termed.Add(1)
+	case outcomeNak:
+		s.naked.Add(1)
+		go s.requeue(context.Background(), m)
+	}
+}
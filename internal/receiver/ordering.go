@@ -0,0 +1,18 @@
+package receiver
+
+// Значения config.OrderingKey.
+const (
+	OrderByCustomer = "customer_id"
+	OrderByUid      = "order_uid"
+)
+
+// partition закрепляет ключ за одним из n накопителей, FNV-1a.
+// Пустой ключ (поле не строка) всегда попадает в первый.
+func partition(key string, n int) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(n))
+}
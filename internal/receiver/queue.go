@@ -0,0 +1,214 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"0lvl/internal/inspector"
+)
+
+// Емкость очереди темы у источников без брокера.
+const defaultQueueSize = 1024
+
+var errSourceClosed = errors.New("source closed")
+
+// outcome — чем завершилась обработка сообщения.
+type outcome int
+
+const (
+	outcomeAck outcome = iota
+	outcomeNak
+	outcomeTerm
+)
+
+// queue — основа источников без брокера: память, файл, HTTP.
+// Сообщения темы лежат в канале, подписчики темы читают его по очереди,
+// settle получает итог каждого сообщения.
+type queue struct {
+	name   string
+	settle func(m *queueMsg, o outcome)
+
+	mu     sync.Mutex
+	topics map[string]chan *queueMsg
+	subs   map[string]int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newQueue(name string, settle func(m *queueMsg, o outcome)) *queue {
+	return &queue{
+		name:   name,
+		settle: settle,
+		topics: make(map[string]chan *queueMsg),
+		subs:   make(map[string]int),
+		done:   make(chan struct{}),
+	}
+}
+
+func (q *queue) topic(subject string) chan *queueMsg {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ch, ok := q.topics[subject]
+	if !ok {
+		ch = make(chan *queueMsg, defaultQueueSize)
+		q.topics[subject] = ch
+	}
+	return ch
+}
+
+// subscribed — есть ли у темы хоть один подписчик.
+func (q *queue) subscribed(subject string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.subs[subject] > 0
+}
+
+// push ставит сообщение в очередь темы,
+// блокируется, пока в очереди нет места, но не дольше ctx.
+func (q *queue) push(ctx context.Context, subject string, data []byte) (*queueMsg, error) {
+	m := q.newMsg(subject, data)
+	if err := q.requeue(ctx, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (q *queue) newMsg(subject string, data []byte) *queueMsg {
+	return &queueMsg{
+		q:       q,
+		subject: subject,
+		data:    data,
+		ts:      time.Now(),
+		result:  make(chan outcome, 1),
+	}
+}
+
+func (q *queue) requeue(ctx context.Context, m *queueMsg) error {
+	select {
+	case <-q.done:
+		return errSourceClosed
+	default:
+	}
+	select {
+	case q.topic(m.subject) <- m:
+		return nil
+	case <-q.done:
+		return errSourceClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Name, Subscribe и Close реализуют OrderSource,
+// параметры подписки не нужны: очередь одна на процесс.
+func (q *queue) Name() string {
+	return q.name
+}
+
+func (q *queue) Subscribe(subject string, _ SubOptions, handler func(inspector.Message)) (Subscription, error) {
+	ch := q.topic(subject)
+	sub := &queueSub{q: q, subject: subject, stop: make(chan struct{})}
+
+	q.mu.Lock()
+	q.subs[subject]++
+	q.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case m := <-ch:
+				handler(m)
+			case <-sub.stop:
+				return
+			case <-q.done:
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// Close останавливает подписчиков. Сообщения, которые они уже не заберут,
+// получают Nak с errSourceClosed: тот, кто ждет итога, не повиснет.
+func (q *queue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.done)
+
+		q.mu.Lock()
+		topics := make([]chan *queueMsg, 0, len(q.topics))
+		for _, ch := range q.topics {
+			topics = append(topics, ch)
+		}
+		q.mu.Unlock()
+
+		for _, ch := range topics {
+			for drained := false; !drained; {
+				select {
+				case m := <-ch:
+					m.err = errSourceClosed
+					m.Nak()
+				default:
+					drained = true
+				}
+			}
+		}
+	})
+	return nil
+}
+
+type queueSub struct {
+	q       *queue
+	subject string
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func (s *queueSub) Close() error {
+	s.once.Do(func() {
+		s.q.mu.Lock()
+		s.q.subs[s.subject]--
+		s.q.mu.Unlock()
+		close(s.stop)
+	})
+	return nil
+}
+
+type queueMsg struct {
+	q       *queue
+	subject string
+	data    []byte
+	ts      time.Time
+	// Content-Type запроса HTTP, пусто — формат по теме.
+	contentType string
+
+	// result получает итог, если источнику нужно его дождаться,
+	// uid и err записываются до него, см. reporter.
+	result chan outcome
+	uid    string
+	err    error
+}
+
+func (m *queueMsg) Data() []byte         { return m.data }
+func (m *queueMsg) Subject() string      { return m.subject }
+func (m *queueMsg) Timestamp() time.Time { return m.ts }
+func (m *queueMsg) Source() string       { return m.q.name }
+func (m *queueMsg) InProgress() error    { return nil }
+func (m *queueMsg) ContentType() string  { return m.contentType }
+
+func (m *queueMsg) Ack() error {
+	m.q.settle(m, outcomeAck)
+	return nil
+}
+
+func (m *queueMsg) Nak() error {
+	m.q.settle(m, outcomeNak)
+	return nil
+}
+
+func (m *queueMsg) Term() error {
+	m.q.settle(m, outcomeTerm)
+	return nil
+}
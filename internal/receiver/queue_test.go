@@ -0,0 +1,55 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueue_Close(t *testing.T) {
+	src := NewHTTPSource("order")
+
+	var msgs []*queueMsg
+	for i := 0; i < 3; i++ {
+		m, err := src.push(context.Background(), "order", []byte("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+
+	src.Close()
+	// Подписчиков не было, каждый ждущий получает Nak.
+	for i, m := range msgs {
+		select {
+		case o := <-m.result:
+			if o != outcomeNak || !errors.Is(m.err, errSourceClosed) {
+				t.Errorf("message %d: got %v %v", i, o, m.err)
+			}
+		default:
+			t.Errorf("message %d has no result after close", i)
+		}
+	}
+
+	if _, err := src.push(context.Background(), "order", []byte("{}")); !errors.Is(err, errSourceClosed) {
+		t.Errorf("push after close: %v", err)
+	}
+}
+
+func TestQueue_PushContext(t *testing.T) {
+	src := NewMemorySource()
+	defer src.Close()
+
+	for i := 0; i < defaultQueueSize; i++ {
+		if err := src.Publish("order", []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := src.push(ctx, "order", []byte("{}")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("push to full queue: %v", err)
+	}
+}
@@ -1,105 +1,241 @@
 package receiver
 
 import (
-	"runtime"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"0lvl/config"
 	"0lvl/internal/inspector"
 	"0lvl/internal/repository"
 
-	stan "github.com/nats-io/stan.go"
 	"github.com/rs/zerolog"
 )
 
-/* Stan Options */
-const (
-	// maxInflight — максимальное количество сообщений,
-	// которые будет отправлять кластер без подтверждения.
-	defaultMaxInflight = 1024
-
-	// Повторно заказы прилетят из stan если их не подтвердить за defaultAckWait
-	// В редких случаях при получении повторных заказов
-	// Receiver пологается на Postgres ограничение уникальности.
-	defaultAckWait = 5 * time.Minute
-)
-
-/* Receiver Options */
-const (
-	// Количество накопителей на каждого подписчика.
-	defaultCumCount = 2
-
-	// defaultMaxSize — максимальный размер пакета заказов отправленных в базу данных.
-	defaultMaxSize = 512
-
-	// если трафик низкий пакет отправится по дедлайну не дожидаясь максимального размера.
-	defaultDeadline = 256 // ms
-)
-
 type Receiver struct {
-	conn stan.Conn
-
-	cfg  config.Config
-	repo *repository.Repo
-	log  zerolog.Logger
+	sources []OrderSource
+	routes  []route
+
+	// reconf не дает менять топологию одновременно и во время остановки,
+	// mu охраняет gen — текущее поколение подписчиков и накопителей.
+	reconf sync.Mutex
+	mu     sync.Mutex
+	gen    *generation
+
+	// done закрывается при остановке, прерывает повторы сохранения.
+	done chan struct{}
+	bp   *backpressure
+
+	// rejects — отвергнутые инспектором заказы по пути в dead letter:
+	// обратный вызов подписчика не ждет базу, пишет letters.
+	rejects chan inspector.OrderBox
+	letters sync.WaitGroup
+
+	cfg       config.Config
+	repo      *repository.Repo
+	schemas   *inspector.Registry
+	transform *inspector.Transformer
+	log       zerolog.Logger
 }
 
 // Инициализирует ресивер.
-// Создает соединение Stan.
-func New(repo *repository.Repo, cfg config.Config, log zerolog.Logger) (*Receiver, error) {
-	// Этот обратный вызов будет вызван, если клиент окончательно потеряет
-	// контакт с сервером (или другой клиент заменяет его во время пребывания conn.Close()).
-	connectionLost := func(_ stan.Conn, reason error) {
-		log.Error().Err(reason).Msg("stan callback error")
+// Без sources подключается к источникам из cfg:
+// stan, JetStream или оба, см. config.Transport, файл и HTTP.
+func New(repo *repository.Repo, schemas *inspector.Registry, transform *inspector.Transformer, cfg config.Config, log zerolog.Logger, sources ...OrderSource) (*Receiver, error) {
+	routes, err := newRoutes(schemas, cfg.StanEncodings)
+	if err != nil {
+		return nil, err
 	}
-	opt := stan.SetConnectionLostHandler(connectionLost)
 
-	conn, err := stan.Connect(cfg.StanClusterId, cfg.StanClientId, opt)
-	if err != nil {
+	switch cfg.BatchMode {
+	case BatchFixed, BatchAdaptive:
+	default:
+		return nil, fmt.Errorf("unknown batch mode %q", cfg.BatchMode)
+	}
+	switch cfg.OrderingKey {
+	case "", OrderByCustomer, OrderByUid:
+	default:
+		return nil, fmt.Errorf("unknown ordering key %q", cfg.OrderingKey)
+	}
+	if err := topologyFromConfig(cfg).validate(cfg.OrderingKey != ""); err != nil {
 		return nil, err
 	}
+	if cfg.QueueSize < 0 || cfg.PauseLatency > 0 && cfg.PauseCooldown <= 0 {
+		return nil, fmt.Errorf("queue size must not be negative and pause cooldown must be positive")
+	}
+	if cfg.BatchMaxSize < 1 || cfg.BatchDeadline <= 0 {
+		return nil, fmt.Errorf("batch max size and deadline must be positive")
+	}
+	// Поток JetStream собирает subject и subject.>: письмо
+	// в такую тему вернулось бы ресиверу заказом.
+	if dl := cfg.DeadLetterSubject; dl != "" && (dl == cfg.StanSubject || strings.HasPrefix(dl, cfg.StanSubject+".")) {
+		return nil, fmt.Errorf("dead letter subject %q must be outside %s and %s.>", dl, cfg.StanSubject, cfg.StanSubject)
+	}
+
+	if len(sources) == 0 {
+		sources, err = newSources(cfg, log)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	rec := &Receiver{
-		conn: conn,
-		cfg:  cfg,
-		repo: repo,
-		log:  log,
+		sources:   sources,
+		routes:    routes,
+		done:      make(chan struct{}),
+		bp:        newBackpressure(cfg),
+		rejects:   make(chan inspector.OrderBox, cfg.QueueSize),
+		cfg:       cfg,
+		repo:      repo,
+		schemas:   schemas,
+		transform: transform,
+		log:       log,
 	}
 
 	return rec, nil
 }
 
-// Закрывает соединение stan.Conn.
+// Stats возвращает текущие параметры всех накопителей.
+func (r *Receiver) Stats() []BatchStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen == nil {
+		return nil
+	}
+
+	stats := make([]BatchStats, 0, len(r.gen.tuners))
+	for _, t := range r.gen.tuners {
+		stats = append(stats, t.snapshot())
+	}
+	return stats
+}
+
+// Закрывает все источники.
 func (r *Receiver) Close() {
-	r.conn.Close()
+	for _, src := range r.sources {
+		if err := src.Close(); err != nil {
+			r.log.Error().Err(err).Str("source", src.Name()).Msg("source close error")
+		}
+	}
+}
+
+// HTTPSource возвращает источник HTTP, если он включен, иначе nil.
+func (r *Receiver) HTTPSource() *HTTPSource {
+	for _, src := range r.sources {
+		if h, ok := src.(*HTTPSource); ok {
+			return h
+		}
+	}
+	return nil
+}
+
+// Shutdown останавливает прием: закрывает подписки,
+// накопители сливают свои пакеты в базу и подтверждают заказы,
+// отвергнутые заказы дописываются в dead letter.
+// Заказы, которые не успели попасть в накопитель,
+// получают Nak и будут доставлены снова.
+// Источники закрываются в любом случае, даже если ctx истек раньше.
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	r.reconf.Lock()
+	defer r.reconf.Unlock()
+
+	r.mu.Lock()
+	gen := r.gen
+	r.mu.Unlock()
+
+	if gen != nil {
+		r.halt(gen)
+	}
+	close(r.done)
+	// После halt подписчики в rejects уже не пишут.
+	close(r.rejects)
+
+	var err error
+	if gen != nil {
+		err = wait(ctx, &gen.wg)
+	}
+	if err == nil {
+		err = wait(ctx, &r.letters)
+	}
+
+	r.Close()
+	return err
 }
 
-// Запускает подписчиков.
+// Запускает подписчиков с топологией из config.
+func (r *Receiver) Run() error {
+	r.letters.Add(1)
+	go r.writeLetters()
+	return r.SetTopology(context.Background(), topologyFromConfig(r.cfg))
+}
+
+// start запускает поколение подписчиков.
 // Каждый подписчик передает канал
 // нескольким накопителям.
-func (r *Receiver) Run() error {
-	// Количество подписчиков.
-	subCount := runtime.NumCPU() / 2
-	// Количество накопителей на каждого подписчика.
-	cumCount := defaultCumCount
+//
+// Подписывается на все темы из routes в каждом источнике.
+// С config.OrderingKey у накопителей поколения свои каналы,
+// общие на все темы и источники: заказы с одним ключом попадают
+// к одному накопителю, откуда бы ни пришли.
+func (r *Receiver) start(t Topology) (*generation, error) {
+	gen := &generation{topo: t, stop: make(chan struct{}), quiet: make(chan struct{})}
+
+	var shared []chan inspector.OrderBox
+	if r.cfg.OrderingKey != "" {
+		label := "ordered:" + r.cfg.StanSubject
+		shared = r.queues(gen, t.Accumulators, label)
+		r.massCumulate(gen, shared, label)
+	}
 
-	for i := 0; i < subCount; i++ {
-		ch, err := r.subscriber()
-		if err != nil {
-			return err
+	for _, src := range r.sources {
+		for i := 0; i < t.Subscribers; i++ {
+			for _, rt := range r.routes {
+				chs := shared
+				label := src.Name() + ":" + r.cfg.StanSubject + rt.suffix(".")
+				if chs == nil {
+					chs = r.queues(gen, 1, label)
+				}
+				if err := r.subscriber(gen, src, rt, chs); err != nil {
+					r.halt(gen)
+					return nil, err
+				}
+				if shared == nil {
+					r.massCumulate(gen, chs, label)
+				}
+			}
 		}
-		r.massCumulate(ch, cumCount)
 	}
-	return nil
+	return gen, nil
 }
 
-// Запускает накопителей с разным таймингом обращений в базу данных.
-func (r *Receiver) massCumulate(ch <-chan inspector.OrderBox, cumCount int) {
-	size := defaultMaxSize
-	deadline := defaultDeadline
+// queues создает n очередей к накопителям поколения,
+// subject — подпись в BackpressureStats.
+func (r *Receiver) queues(gen *generation, n int, subject string) []chan inspector.OrderBox {
+	chs := make([]chan inspector.OrderBox, n)
+	for i := range chs {
+		chs[i] = make(chan inspector.OrderBox, r.cfg.QueueSize)
+	}
+	gen.queues = append(gen.queues, genQueue{subject: subject, chs: chs})
+	return chs
+}
 
-	for i := 0; i < cumCount; i++ {
-		go r.cumulative(ch, size, deadline)
+// Запускает накопителей с разным таймингом обращений в базу данных.
+// Накопитель i читает chs[i], если каналов меньше — все читают chs[0].
+// subject — подпись накопителей в BatchStats.
+func (r *Receiver) massCumulate(gen *generation, chs []chan inspector.OrderBox, subject string) {
+	size := r.cfg.BatchMaxSize
+	deadline := r.cfg.BatchDeadline
+
+	for i := 0; i < gen.topo.Accumulators; i++ {
+		t := newTuner(r.cfg, subject, size, deadline)
+		gen.tuners = append(gen.tuners, t)
+
+		gen.wg.Add(1)
+		go r.cumulative(gen, chs[i%len(chs)], t)
 		// Это немного раскидывает тайминг запросов в базу данных
 		// но только в рамках одного подписчика.
 		size = size - (size*32)/100
@@ -111,39 +247,88 @@ func (r *Receiver) massCumulate(ch <-chan inspector.OrderBox, cumCount int) {
 // На каждый обратный вызов проверяет данные
 // и отправляет по каналу
 // который читают несколько накопителей - cumulative
-func (r *Receiver) subscriber() (<-chan inspector.OrderBox, error) {
-	ch := make(chan inspector.OrderBox)
-	ins := inspector.New()
+//
+// С config.OrderingKey chs — каналы всех накопителей поколения,
+// заказ попадает в канал по значению ключа, поэтому заказы
+// с одним ключом сохраняются одним накопителем в порядке получения.
+func (r *Receiver) subscriber(gen *generation, src OrderSource, rt route, chs []chan inspector.OrderBox) error {
+	ins := r.newInspector(r.dateWindow())
+	limit := r.bp.limiter()
+
+	subject := r.cfg.StanSubject + rt.suffix(".")
+
+	accept := func(m inspector.Message) {
+		gen.mu.RLock()
+		defer gen.mu.RUnlock()
+
+		// Пауза и ограничитель держат обратный вызов,
+		// брокер придерживает остальное до MaxInflight.
+		if !r.bp.wait(gen.stop) || !limit.take(gen.stop) {
+			m.Nak()
+			return
+		}
 
-	accept := func(m *stan.Msg) {
 		newBox := inspector.OrderBox{
-			Msg:  m,
-			Data: m.Data,
+			Version:  rt.version,
+			Encoding: rt.encodingOf(m),
+			Msg:      m,
+			Data:     m.Data(),
 		}
 
 		box := ins.Audit(newBox)
 		if box.Err != nil {
-			r.log.Warn().Err(box.Err).Msg("inspector audit error")
-			//TODO:подтвердить с ошибкой
-			//nats Term()
-			m.Ack()
+			r.log.Warn().Err(box.Err).Str("schema version", box.Version).Msg("inspector audit error")
+			r.reject(gen, box)
+			return
+		}
+
+		// В базу уходит каноническое представление
+		// без полей, которые не нужно хранить.
+		box = r.transform.Canonical(box)
+		if box.Err != nil {
+			r.log.Error().Err(box.Err).Str("order uid", box.Uid).Msg("inspector transform error")
+			r.reject(gen, box)
 			return
 		}
-		ch <- box
+		ch := chs[0]
+		if len(chs) > 1 {
+			ch = chs[partition(box.Key, len(chs))]
+		}
+		select {
+		case <-gen.stop:
+			m.Nak()
+			return
+		default:
+		}
+		select {
+		case ch <- box:
+		case <-gen.stop:
+			m.Nak()
+		}
 	}
 
-	_, err := r.conn.QueueSubscribe(
-		r.cfg.StanSubject,
-		r.cfg.StanQueue,
-		accept,
-		stan.DurableName("service orders"),
-		stan.SetManualAckMode(),
-		stan.AckWait(defaultAckWait),
-		stan.MaxInflight(defaultMaxInflight),
-	)
+	sub, err := src.Subscribe(subject, gen.topo.subOptions(rt), accept)
+	if err != nil {
+		return err
+	}
+	gen.subs = append(gen.subs, sub)
+	return nil
+}
 
-	//QueueSubscribe закроется неявно при закрытии stan.Conn
-	return ch, err
+func (r *Receiver) dateWindow() inspector.DateWindow {
+	return inspector.DateWindow{
+		MaxFuture:   r.cfg.DateMaxFuture,
+		MaxAge:      r.cfg.DateMaxAge,
+		PaymentSkew: r.cfg.PaymentSkew,
+	}
+}
+
+func (r *Receiver) newInspector(dates inspector.DateWindow) inspector.Ispector {
+	return inspector.New(
+		inspector.WithPartitionKey(r.cfg.OrderingKey),
+		inspector.WithRegistry(r.schemas),
+		inspector.WithDateWindow(dates),
+	)
 }
 
 // Накопитель принимает проверенные данные,
@@ -166,42 +351,273 @@ func (r *Receiver) subscriber() (<-chan inspector.OrderBox, error) {
 // (g 2) flush 126
 // (g 1) append 1
 // (g 1) append 1
-func (r *Receiver) cumulative(ch <-chan inspector.OrderBox, size int, deadline int) {
+//
+// Размер пакета и дедлайн после каждого слива подбирает tuner.
+func (r *Receiver) cumulative(gen *generation, ch <-chan inspector.OrderBox, t *tuner) {
+	defer gen.wg.Done()
+	size, deadline := t.params()
 	batch := make([]*inspector.OrderBox, 0, size)
 
 	flush := func() {
-		results := r.repo.SaveOrderBatch(batch)
-
-		for _, box := range results {
-			if box.Err != nil {
-				r.log.Error().Err(box.Err).Str("order uid", box.Uid).Msg("save error")
-				//TODO:подтвердить с ошибкой
-				//nats Term()
-				box.Msg.Ack()
-			}
-			box.Msg.Ack()
-		}
-
+		latency := r.save(batch)
+		t.observe(len(batch), latency)
+		r.bp.observe(latency)
 		batch = batch[:0]
+		size, deadline = t.params()
 	}
 
-	d := time.Duration(deadline)
-	ticker := time.NewTicker(d * time.Millisecond)
+	ticker := time.NewTicker(deadline)
 
 	for {
 		select {
+		case <-gen.quiet:
+			ticker.Stop()
+			// Очередь делят несколько накопителей, каждый берет что успеет.
+			for drained := false; !drained; {
+				select {
+				case box := <-ch:
+					batch = append(batch, &box)
+					if len(batch) >= size {
+						flush()
+					}
+				default:
+					drained = true
+				}
+			}
+			if len(batch) > 0 {
+				flush()
+			}
+			return
+
 		case <-ticker.C:
 			if len(batch) > 0 {
 				flush()
+				ticker.Reset(deadline)
 			}
 
 		case box := <-ch:
 			batch = append(batch, &box)
 
-			if len(batch) == size {
+			if len(batch) >= size {
 				flush()
-				ticker.Reset(d * time.Millisecond)
+				ticker.Reset(deadline)
+			}
+		}
+	}
+}
+
+// save сохраняет пакет и подтверждает только те заказы,
+// судьба которых решена: сохранены, уже были в базе или ушли в dead letter.
+// Временные ошибки повторяются с растущей паузой,
+// после последней попытки заказы остаются неподтвержденными.
+// Возвращает время первой попытки сохранения.
+//
+// С config.OrderingKey в каждый вызов SaveOrderBatch идет
+// не больше одного заказа на ключ, см. splitByKey: следующий заказ
+// с тем же ключом ждет, пока судьба предыдущего не решится,
+// и получает Nak вместе с ним, если повторы кончились.
+func (r *Receiver) save(batch []*inspector.OrderBox) (latency time.Duration) {
+	ordered := r.cfg.OrderingKey != ""
+	pending, held := batch, []*inspector.OrderBox(nil)
+	if ordered {
+		pending, held = splitByKey(batch)
+	}
+	backoff := r.cfg.SaveBackoff
+
+	for attempt, call := 0, 0; ; call++ {
+		start := time.Now()
+		results := r.repo.SaveOrderBatch(pending)
+		if call == 0 {
+			latency = time.Since(start)
+		}
+
+		// retry не делит память с pending: по results еще идем.
+		retry := make([]*inspector.OrderBox, 0, len(results))
+		for _, box := range results {
+			switch repository.Classify(box.Err) {
+			case repository.ErrorNone:
+				report(box)
+				box.Msg.Ack()
+
+			case repository.ErrorDuplicate:
+				r.log.Debug().Str("order uid", box.Uid).Msg("order already saved")
+				report(box)
+				box.Msg.Ack()
+
+			case repository.ErrorConflict:
+				r.log.Warn().Err(box.Err).Str("order uid", box.Uid).Msg("order conflict")
+				r.deadLetter(box, repository.ReasonConflict)
+
+			case repository.ErrorPermanent:
+				r.log.Error().Err(box.Err).Str("order uid", box.Uid).Msg("save error")
+				r.deadLetter(box, repository.ReasonFailed)
+
+			case repository.ErrorTransient:
+				retry = append(retry, box)
+			}
+		}
+
+		if len(retry) > 0 && attempt >= r.cfg.SaveRetries {
+			r.log.Error().Err(retry[0].Err).Int("count orders", len(retry)).Msg("save retries exhausted, left for redelivery")
+			var behind []*inspector.OrderBox
+			behind, held = sameKey(retry, held)
+			nak(retry)
+			nak(behind)
+			retry = retry[:0]
+		}
+		if len(retry) == 0 && len(held) == 0 {
+			return
+		}
+
+		if len(retry) > 0 {
+			r.log.Warn().Err(retry[0].Err).Int("count orders", len(retry)).Dur("backoff", backoff).Msg("transient save error, retry")
+			for _, box := range retry {
+				box.Err = nil
+				box.Msg.InProgress()
+			}
+			for _, box := range held {
+				box.Msg.InProgress()
+			}
+
+			// При остановке не ждем: заказы будут доставлены снова.
+			select {
+			case <-time.After(backoff):
+			case <-r.done:
+				nak(retry)
+				nak(held)
+				return
+			}
+			attempt++
+			backoff *= 2
+			if backoff > r.cfg.SaveMaxBackoff {
+				backoff = r.cfg.SaveMaxBackoff
 			}
 		}
+
+		pending = retry
+		if ordered {
+			// Повторяемые заказы раньше придержанных с тем же ключом.
+			pending, held = splitByKey(append(retry, held...))
+		}
+	}
+}
+
+// splitByKey оставляет в pending первый заказ каждого ключа,
+// остальные в порядке пакета уходят в held.
+func splitByKey(batch []*inspector.OrderBox) (pending, held []*inspector.OrderBox) {
+	seen := make(map[string]bool, len(batch))
+	for _, box := range batch {
+		if seen[box.Key] {
+			held = append(held, box)
+			continue
+		}
+		seen[box.Key] = true
+		pending = append(pending, box)
+	}
+	return pending, held
+}
+
+// sameKey делит held на заказы с ключами из failed и остальные.
+func sameKey(failed, held []*inspector.OrderBox) (same, rest []*inspector.OrderBox) {
+	keys := make(map[string]bool, len(failed))
+	for _, box := range failed {
+		keys[box.Key] = true
+	}
+	for _, box := range held {
+		if keys[box.Key] {
+			same = append(same, box)
+		} else {
+			rest = append(rest, box)
+		}
+	}
+	return same, rest
+}
+
+func nak(batch []*inspector.OrderBox) {
+	for _, box := range batch {
+		report(box)
+		box.Msg.Nak()
+	}
+}
+
+// reject ставит отвергнутый заказ в очередь к writeLetters,
+// при остановке поколения заказ получает Nak и придет снова.
+func (r *Receiver) reject(gen *generation, box inspector.OrderBox) {
+	select {
+	case r.rejects <- box:
+	case <-gen.stop:
+		nak([]*inspector.OrderBox{&box})
+	}
+}
+
+// writeLetters пишет отвергнутые подписчиками заказы в dead letter,
+// пока rejects не закроют при остановке.
+func (r *Receiver) writeLetters() {
+	defer r.letters.Done()
+	for box := range r.rejects {
+		r.deadLetter(&box, repository.ReasonRejected)
+	}
+}
+
+// deadLetter сохраняет заказ, который не попадет в trade,
+// в rejected_order и, если задана, в тему DeadLetterSubject
+// того же источника.
+// Сообщение завершается Term, только если заказ сохранился хотя бы где-то,
+// иначе получает Nak и придет снова.
+func (r *Receiver) deadLetter(box *inspector.OrderBox, reason string) {
+	rec := repository.NewRejectedOrder(box, reason)
+	stored := false
+
+	if err := r.repo.SaveRejected(rec); err != nil {
+		r.log.Error().Err(err).Str("order uid", box.Uid).Msg("dead letter save error")
+	} else {
+		stored = true
+	}
+
+	if r.cfg.DeadLetterSubject != "" {
+		b, _ := json.Marshal(rec)
+		if err := r.publish(rec.Source, r.cfg.DeadLetterSubject, b); err != nil {
+			r.log.Error().Err(err).Str("order uid", box.Uid).Msg("dead letter publish error")
+		} else {
+			stored = true
+		}
+	}
+
+	report(box)
+	if stored {
+		box.Msg.Term()
+	} else {
+		box.Msg.Nak()
+	}
+}
+
+// Resubmit отправляет отвергнутый заказ повторно в ту тему
+// того источника, из которого он пришел.
+func (r *Receiver) Resubmit(rec repository.RejectedOrder) error {
+	if rec.Subject == "" {
+		return errors.New("rejected order has no subject")
+	}
+	return r.publish(rec.Source, rec.Subject, rec.Payload)
+}
+
+// publish отправляет в источник с именем name,
+// если он не умеет публиковать — в первый, который умеет.
+func (r *Receiver) publish(name, subject string, data []byte) error {
+	var first Publisher
+	for _, src := range r.sources {
+		p, ok := src.(Publisher)
+		if !ok {
+			continue
+		}
+		if src.Name() == name {
+			return p.Publish(subject, data)
+		}
+		if first == nil {
+			first = p
+		}
+	}
+	if first == nil {
+		return errNoPublisher
 	}
+	return first.Publish(subject, data)
 }
@@ -0,0 +1,445 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+	"0lvl/internal/repository"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+// faultyStore — MemStore, у которого первые fails сохранений
+// заканчиваются ошибкой err для всех заказов пакета.
+type faultyStore struct {
+	*repository.MemStore
+
+	mu    sync.Mutex
+	fails int
+	err   error
+}
+
+func (s *faultyStore) SaveOrderBatch(ctx context.Context, batch []*inspector.OrderBox) {
+	s.mu.Lock()
+	fail := s.fails > 0
+	if fail {
+		s.fails--
+	}
+	s.mu.Unlock()
+
+	if !fail {
+		s.MemStore.SaveOrderBatch(ctx, batch)
+		return
+	}
+	for _, box := range batch {
+		box.Err = s.err
+	}
+}
+
+// recordStore — MemStore, который запоминает uid сохраненных заказов
+// в порядке сохранения. Если задан gate, первое сохранение ждет его,
+// fails — сколько раз заказ с uid получит временную ошибку.
+type recordStore struct {
+	*repository.MemStore
+
+	mu      sync.Mutex
+	gate    chan struct{}
+	blocked chan struct{}
+	fails   map[string]int
+	saved   []string
+}
+
+func newRecordStore() *recordStore {
+	return &recordStore{MemStore: repository.NewMemStore(), blocked: make(chan struct{}), fails: make(map[string]int)}
+}
+
+func (s *recordStore) SaveOrderBatch(ctx context.Context, batch []*inspector.OrderBox) {
+	s.mu.Lock()
+	gate := s.gate
+	s.gate = nil
+	s.mu.Unlock()
+	if gate != nil {
+		close(s.blocked)
+		<-gate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	valid := make([]*inspector.OrderBox, 0, len(batch))
+	for _, box := range batch {
+		if s.fails[box.Uid] > 0 {
+			s.fails[box.Uid]--
+			box.Err = &pgconn.PgError{Code: "40001"}
+			continue
+		}
+		valid = append(valid, box)
+	}
+	s.MemStore.SaveOrderBatch(ctx, valid)
+	for _, box := range valid {
+		s.saved = append(s.saved, box.Uid)
+	}
+}
+
+func (s *recordStore) order() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.saved...)
+}
+
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BatchDeadline = 5 * time.Millisecond
+	cfg.BatchMinDeadline = time.Millisecond
+	cfg.SaveBackoff = time.Millisecond
+	cfg.SaveMaxBackoff = time.Millisecond
+	cfg.Subscribers = 1
+	cfg.Accumulators = 1
+	return cfg
+}
+
+// newTestReceiver запускает ресивер с MemorySource над store.
+func newTestReceiver(t *testing.T, cfg config.Config, store repository.OrderStore) (*Receiver, *MemorySource, *repository.Repo) {
+	t.Helper()
+	src := NewMemorySource()
+	rec, repo := startReceiver(t, cfg, store, src)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := rec.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+	return rec, src, repo
+}
+
+// startReceiver запускает ресивер с источником src над store,
+// остановить его должен тест.
+func startReceiver(t *testing.T, cfg config.Config, store repository.OrderStore, src OrderSource) (*Receiver, *repository.Repo) {
+	t.Helper()
+	log := zerolog.Nop()
+
+	repo, err := repository.New(store, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := inspector.NewRegistry()
+	transform, err := inspector.NewTransformer(schemas, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := New(repo, schemas, transform, cfg, log, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return rec, repo
+}
+
+// waitFor ждет, пока cond не станет истинным.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReceiver_Save(t *testing.T) {
+	order := testOrder("recv0000000000000001", "alice")
+	canonical := func(data string) []byte {
+		var b bytes.Buffer
+		json.Compact(&b, []byte(data))
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		data string
+		// Заказ с тем же uid, уже лежащий в базе.
+		seed  string
+		fails int
+		err   error
+
+		acked, naked, termed uint64
+		// Причина записи в rejected_order, пусто — записи нет.
+		reason string
+		saved  bool
+	}{
+		{name: "saved", data: order, acked: 1, saved: true},
+		{name: "transient", data: order, fails: 2, err: &pgconn.PgError{Code: "40001"}, acked: 1, saved: true},
+		{name: "aborted", data: order, fails: 1, err: repository.ErrBatchAborted, acked: 1, saved: true},
+		{name: "duplicate", data: order, seed: order, acked: 1, saved: true},
+		{name: "conflict", data: order, seed: testOrder("recv0000000000000001", "mallory"), termed: 1, reason: repository.ReasonConflict},
+		{name: "permanent", data: order, fails: 1, err: &pgconn.PgError{Code: "22001"}, termed: 1, reason: repository.ReasonFailed},
+		{name: "malformed", data: order, fails: 1, err: repository.ErrMalformed, termed: 1, reason: repository.ReasonFailed},
+		{name: "invalid", data: `{"order_uid": "recv0000000000000001"}`, termed: 1, reason: repository.ReasonRejected},
+		// Повторы кончились: Nak, MemorySource доставит снова.
+		{name: "exhausted", data: order, fails: 1, err: errors.New("conn reset"), acked: 1, naked: 1, saved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.SaveRetries = 2
+			if tt.name == "exhausted" {
+				cfg.SaveRetries = 0
+			}
+
+			store := &faultyStore{MemStore: repository.NewMemStore(), fails: tt.fails, err: tt.err}
+			if tt.seed != "" {
+				store.MemStore.SaveOrderBatch(context.Background(), []*inspector.OrderBox{{
+					Uid:  "recv0000000000000001",
+					Data: canonical(tt.seed),
+				}})
+			}
+			_, src, repo := newTestReceiver(t, cfg, store)
+
+			if err := src.Publish(cfg.StanSubject, []byte(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "settled order", func() bool {
+				acked, _, termed := src.Stats()
+				return acked+termed > 0
+			})
+
+			var recs []repository.RejectedOrder
+			waitFor(t, "rejected order", func() bool {
+				recs, _ = repo.RejectedOrders(10, 0)
+				return len(recs) > 0 || tt.reason == ""
+			})
+
+			acked, naked, termed := src.Stats()
+			if acked != tt.acked || naked != tt.naked || termed != tt.termed {
+				t.Errorf("got acked %d, naked %d, termed %d, want %d, %d, %d", acked, naked, termed, tt.acked, tt.naked, tt.termed)
+			}
+			if len(recs) > 1 || tt.reason != "" && recs[0].Reason != tt.reason {
+				t.Errorf("got rejected %+v, want reason %q", recs, tt.reason)
+			}
+
+			data, err := repo.Order("recv0000000000000001")
+			switch {
+			case tt.saved && (err != nil || !bytes.Contains(data, []byte(`"alice"`))):
+				t.Errorf("order is not saved: %s %v", data, err)
+			case !tt.saved && tt.seed == "" && err == nil:
+				t.Errorf("order must not be saved: %s", data)
+			}
+		})
+	}
+}
+
+// Заказ, сохранение которого идет во время смены топологии,
+// сохраняется раньше следующего заказа того же покупателя.
+func TestReceiver_OrderedTopologyChange(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.OrderingKey = OrderByCustomer
+
+	store := newRecordStore()
+	gate := make(chan struct{})
+	store.gate = gate
+	rec, src, _ := newTestReceiver(t, cfg, store)
+
+	first, second := "topo0000000000000001", "topo0000000000000002"
+	if err := src.Publish(cfg.StanSubject, []byte(testOrder(first, "alice"))); err != nil {
+		t.Fatal(err)
+	}
+	<-store.blocked
+
+	topo := rec.Topology()
+	topo.Accumulators = 3
+	changed := make(chan error, 1)
+	go func() {
+		changed <- rec.SetTopology(context.Background(), topo)
+	}()
+	// Смена топологии доходит до ожидания старого накопителя.
+	time.Sleep(20 * time.Millisecond)
+
+	if err := src.Publish(cfg.StanSubject, []byte(testOrder(second, "alice"))); err != nil {
+		t.Fatal(err)
+	}
+	// Время новому поколению, чтобы обогнать первый заказ, если оно уже работает.
+	time.Sleep(50 * time.Millisecond)
+	if saved := store.order(); len(saved) != 0 {
+		t.Errorf("got saved %v before the first order", saved)
+	}
+	close(gate)
+
+	if err := <-changed; err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Topology().Accumulators; got != 3 {
+		t.Errorf("got %d accumulators, want 3", got)
+	}
+	waitFor(t, "saved orders", func() bool { return len(store.order()) == 2 })
+	if saved := store.order(); saved[0] != first || saved[1] != second {
+		t.Errorf("got saved %v, want %s then %s", saved, first, second)
+	}
+}
+
+// Заказы одного покупателя из разных тем идут к одному накопителю:
+// второй ждет, пока сохраняется первый.
+func TestReceiver_OrderedAcrossRoutes(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.OrderingKey = OrderByCustomer
+	cfg.Accumulators = 4
+
+	store := newRecordStore()
+	gate := make(chan struct{})
+	store.gate = gate
+	_, src, _ := newTestReceiver(t, cfg, store)
+
+	first, second := "rout0000000000000001", "rout0000000000000002"
+	if err := src.Publish(cfg.StanSubject, []byte(testOrder(first, "alice"))); err != nil {
+		t.Fatal(err)
+	}
+	<-store.blocked
+	if err := src.Publish(cfg.StanSubject+".1", []byte(testOrder(second, "alice"))); err != nil {
+		t.Fatal(err)
+	}
+	// Время второму заказу обогнать первый, если он попал к другому накопителю.
+	time.Sleep(50 * time.Millisecond)
+	if saved := store.order(); len(saved) != 0 {
+		t.Errorf("got saved %v before the first order", saved)
+	}
+	close(gate)
+
+	waitFor(t, "saved orders", func() bool { return len(store.order()) == 2 })
+	if saved := store.order(); saved[0] != first || saved[1] != second {
+		t.Errorf("got saved %v, want %s then %s", saved, first, second)
+	}
+}
+
+// Письма в тему заказов вернулись бы в прием: такую тему ресивер не принимает.
+func TestReceiver_DeadLetterSubject(t *testing.T) {
+	tests := map[string]bool{
+		"":             true,
+		"order_dead":   true,
+		"dead.order":   true,
+		"order":        false,
+		"order.dead":   false,
+		"order.2.json": false,
+	}
+	for subject, ok := range tests {
+		cfg := testConfig(t)
+		cfg.StanSubject = "order"
+		cfg.DeadLetterSubject = subject
+
+		repo, err := repository.New(repository.NewMemStore(), zerolog.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemas := inspector.NewRegistry()
+		transform, err := inspector.NewTransformer(schemas, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := New(repo, schemas, transform, cfg, zerolog.Nop(), NewMemorySource())
+		if (err == nil) != ok {
+			t.Errorf("dead letter subject %q: got %v", subject, err)
+		}
+		if rec != nil {
+			rec.Close()
+		}
+	}
+}
+
+// Заказ того же покупателя ждет, пока повторяется предыдущий.
+func TestReceiver_OrderedRetry(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.OrderingKey = OrderByCustomer
+	cfg.BatchDeadline = 50 * time.Millisecond
+	cfg.SaveRetries = 3
+
+	uids := []string{"retr0000000000000001", "retr0000000000000002", "retr0000000000000003"}
+	store := newRecordStore()
+	store.fails[uids[0]] = 2
+	_, src, _ := newTestReceiver(t, cfg, store)
+
+	for _, uid := range uids {
+		if err := src.Publish(cfg.StanSubject, []byte(testOrder(uid, "alice"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "saved orders", func() bool { return len(store.order()) == len(uids) })
+	saved := store.order()
+	for i := range uids {
+		if saved[i] != uids[i] {
+			t.Fatalf("got saved %v, want %v", saved, uids)
+		}
+	}
+	if acked, naked, termed := src.Stats(); acked != 3 || naked != 0 || termed != 0 {
+		t.Errorf("got acked %d, naked %d, termed %d, want 3, 0, 0", acked, naked, termed)
+	}
+}
+
+func testOrder(uid, customer string) string {
+	return fmt.Sprintf(orderTemplate, uid, customer)
+}
+
+const orderTemplate = `{
+	"order_uid": %[1]q,
+	"track_number": "WBILMTESTTRACK",
+	"entry": "WBIL",
+	"delivery": {
+		"name": "Test Testov",
+		"phone": "+9720000000",
+		"zip": "2639809",
+		"city": "Kiryat Mozkin",
+		"address": "Ploshad Mira 15",
+		"region": "Kraiot",
+		"email": "test@gmail.com"
+	},
+	"payment": {
+		"transaction": %[1]q,
+		"request_id": "",
+		"currency": "USD",
+		"provider": "wbpay",
+		"amount": 1817,
+		"payment_dt": 1637907727,
+		"bank": "alpha",
+		"delivery_cost": 1500,
+		"goods_total": 317,
+		"custom_fee": 0
+	},
+	"items": [
+		{
+			"chrt_id": 9934930,
+			"track_number": "WBILMTESTTRACK",
+			"price": 453,
+			"rid": "ab4219087a764ae0btest",
+			"name": "Mascaras",
+			"sale": 30,
+			"size": "0",
+			"total_price": 317,
+			"nm_id": 2389212,
+			"brand": "Vivienne Sabo",
+			"status": 202
+		}
+	],
+	"locale": "en",
+	"internal_signature": "",
+	"customer_id": %[2]q,
+	"delivery_service": "meest",
+	"shardkey": "9",
+	"sm_id": 99,
+	"date_created": "2021-11-26T06:22:19Z",
+	"oof_shard": "1"
+}`
@@ -0,0 +1,196 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"0lvl/internal/inspector"
+	"0lvl/internal/repository"
+)
+
+// Сколько ждать следующего сообщения истории, прежде чем считать ее прочитанной.
+const defaultReplayIdle = 5 * time.Second
+
+var errNoReplayer = errors.New("no source can replay")
+
+// ReplayRange — какую часть истории темы перечитать.
+// Начало: SinceSeq или SinceTime, без них — с самого начала.
+// Конец: UntilSeq или UntilTime включительно, без них — пока история
+// не кончится. История кончилась, если Idle не было новых сообщений.
+type ReplayRange struct {
+	SinceSeq  uint64
+	SinceTime time.Time
+	UntilSeq  uint64
+	UntilTime time.Time
+	Idle      time.Duration
+}
+
+// before — сообщение раньше начала диапазона,
+// для источников, которые не умеют начать с него сами.
+func (rng ReplayRange) before(seq uint64, ts time.Time) bool {
+	switch {
+	case rng.SinceSeq > 0:
+		return seq < rng.SinceSeq
+	case !rng.SinceTime.IsZero():
+		return ts.Before(rng.SinceTime)
+	}
+	return false
+}
+
+// past — сообщение уже за концом диапазона.
+func (rng ReplayRange) past(seq uint64, ts time.Time) bool {
+	return rng.UntilSeq > 0 && seq > rng.UntilSeq ||
+		!rng.UntilTime.IsZero() && ts.After(rng.UntilTime)
+}
+
+func (rng ReplayRange) idle() time.Duration {
+	if rng.Idle > 0 {
+		return rng.Idle
+	}
+	return defaultReplayIdle
+}
+
+// Replayer — источник, который умеет перечитать историю темы
+// отдельной подпиской без durable, не сдвигая позицию сервиса.
+// handler вызывается по одному сообщению в порядке темы,
+// подтверждать сообщения не нужно.
+type Replayer interface {
+	Replay(ctx context.Context, subject string, rng ReplayRange, handler func(inspector.Message)) error
+}
+
+// ReplayStats — итог Replay.
+type ReplayStats struct {
+	Read       uint64 `json:"read"`
+	Saved      uint64 `json:"saved"`
+	Duplicates uint64 `json:"duplicates"`
+	Conflicts  uint64 `json:"conflicts"`
+	Rejected   uint64 `json:"rejected"`
+	Failed     uint64 `json:"failed"`
+}
+
+// Replay перечитывает историю всех тем из routes в каждом источнике,
+// который умеет Replayer, и сохраняет заказы пакетами по BatchMaxSize.
+// Сохранение идемпотентно: уже сохраненные заказы попадают в Duplicates.
+// Отвергнутые и несохраненные заказы только считаются,
+// в rejected_order они попали при первом получении.
+// Run для Replay не нужен.
+func (r *Receiver) Replay(ctx context.Context, rng ReplayRange) (ReplayStats, error) {
+	var st ReplayStats
+
+	// История старше MaxAge по определению.
+	dates := r.dateWindow()
+	dates.MaxAge = 0
+
+	replayed := false
+	for _, src := range r.sources {
+		rp, ok := src.(Replayer)
+		if !ok {
+			continue
+		}
+		replayed = true
+
+		for _, rt := range r.routes {
+			ins := r.newInspector(dates)
+			subject := r.cfg.StanSubject + rt.suffix(".")
+			batch := make([]*inspector.OrderBox, 0, r.cfg.BatchMaxSize)
+
+			handler := func(m inspector.Message) {
+				st.Read++
+				box := ins.Audit(inspector.OrderBox{
+					Version:  rt.version,
+					Encoding: rt.encodingOf(m),
+					Msg:      m,
+					Data:     m.Data(),
+				})
+				if box.Err == nil {
+					box = r.transform.Canonical(box)
+				}
+				if box.Err != nil {
+					st.Rejected++
+					r.log.Warn().Err(box.Err).Str("order uid", box.Uid).Msg("replay rejected")
+					return
+				}
+
+				batch = append(batch, &box)
+				if len(batch) == cap(batch) {
+					r.replaySave(ctx, batch, &st)
+					batch = batch[:0]
+				}
+			}
+
+			err := rp.Replay(ctx, subject, rng, handler)
+			if len(batch) > 0 {
+				r.replaySave(ctx, batch, &st)
+			}
+			if err == nil {
+				// Остановка во время сохранения последнего пакета.
+				err = ctx.Err()
+			}
+			if err != nil {
+				return st, err
+			}
+			r.log.Info().Str("source", src.Name()).Str("subject", subject).Interface("stats", st).Msg("replay subject done")
+		}
+	}
+
+	if !replayed {
+		return st, errNoReplayer
+	}
+	return st, nil
+}
+
+// replaySave сохраняет пакет как save, но без подтверждений и dead letter.
+// Если ctx истек во время паузы между повторами,
+// несохраненные заказы считаются в Failed.
+func (r *Receiver) replaySave(ctx context.Context, batch []*inspector.OrderBox, st *ReplayStats) {
+	pending := batch
+	backoff := r.cfg.SaveBackoff
+
+	for attempt := 0; ; attempt++ {
+		results := r.repo.SaveOrderBatch(pending)
+		// retry не делит память с pending: по results еще идем.
+		retry := make([]*inspector.OrderBox, 0, len(results))
+		for _, box := range results {
+			switch repository.Classify(box.Err) {
+			case repository.ErrorNone:
+				st.Saved++
+			case repository.ErrorDuplicate:
+				st.Duplicates++
+			case repository.ErrorConflict:
+				st.Conflicts++
+				r.log.Warn().Str("order uid", box.Uid).Msg("replay conflict")
+			case repository.ErrorPermanent:
+				st.Failed++
+				r.log.Error().Err(box.Err).Str("order uid", box.Uid).Msg("replay save error")
+			case repository.ErrorTransient:
+				retry = append(retry, box)
+			}
+		}
+
+		if len(retry) == 0 {
+			return
+		}
+		if attempt >= r.cfg.SaveRetries {
+			st.Failed += uint64(len(retry))
+			r.log.Error().Err(retry[0].Err).Int("count orders", len(retry)).Msg("replay save retries exhausted")
+			return
+		}
+
+		for _, box := range retry {
+			box.Err = nil
+		}
+		pending = retry
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			st.Failed += uint64(len(retry))
+			r.log.Error().Err(ctx.Err()).Int("count orders", len(retry)).Msg("replay stopped before save")
+			return
+		}
+		backoff = minOf(backoff*2, r.cfg.SaveMaxBackoff)
+	}
+}
@@ -0,0 +1,135 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"0lvl/internal/inspector"
+	"0lvl/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+// newReplayReceiver — ресивер над store без Run: подписчики
+// не заберут заказы из очереди, в базу они попадут только через Replay.
+func newReplayReceiver(t *testing.T, store repository.OrderStore) (*Receiver, *MemorySource, *repository.Repo) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.SaveRetries = 5
+	cfg.SaveBackoff = time.Hour
+	cfg.SaveMaxBackoff = time.Hour
+	log := zerolog.Nop()
+
+	repo, err := repository.New(store, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := inspector.NewRegistry()
+	transform, err := inspector.NewTransformer(schemas, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := NewMemorySource()
+	rec, err := New(repo, schemas, transform, cfg, log, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rec.Close)
+	return rec, src, repo
+}
+
+func TestReceiver_ReplayRange(t *testing.T) {
+	var uids []string
+	for i := 1; i <= 5; i++ {
+		uids = append(uids, fmt.Sprintf("repl%016d", i))
+	}
+
+	tests := []struct {
+		name string
+		rng  func(mid time.Time) ReplayRange
+		// Номера перечитанных заказов в uids с 1.
+		from, to int
+	}{
+		{"all", func(time.Time) ReplayRange { return ReplayRange{} }, 1, 5},
+		{"since seq", func(time.Time) ReplayRange { return ReplayRange{SinceSeq: 3} }, 3, 5},
+		{"since time", func(mid time.Time) ReplayRange { return ReplayRange{SinceTime: mid} }, 3, 5},
+		{"until seq", func(time.Time) ReplayRange { return ReplayRange{UntilSeq: 2} }, 1, 2},
+		{"until time", func(mid time.Time) ReplayRange { return ReplayRange{UntilTime: mid} }, 1, 2},
+		{"since and until", func(time.Time) ReplayRange { return ReplayRange{SinceSeq: 2, UntilSeq: 4} }, 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, src, repo := newReplayReceiver(t, repository.NewMemStore())
+
+			var mid time.Time
+			for i, uid := range uids {
+				if i == 2 {
+					mid = time.Now()
+				}
+				if err := src.Publish(rec.cfg.StanSubject, []byte(testOrder(uid, "alice"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			st, err := rec.Replay(context.Background(), tt.rng(mid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := uint64(tt.to - tt.from + 1)
+			if st.Read != want || st.Saved != want {
+				t.Errorf("got %+v, want %d read and saved", st, want)
+			}
+			for i, uid := range uids {
+				_, err := repo.Order(uid)
+				if replayed := i+1 >= tt.from && i+1 <= tt.to; replayed != (err == nil) {
+					t.Errorf("order %d: replayed %v, got %v", i+1, replayed, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiver_ReplayStop(t *testing.T) {
+	t.Run("canceled", func(t *testing.T) {
+		rec, src, _ := newReplayReceiver(t, repository.NewMemStore())
+		if err := src.Publish(rec.cfg.StanSubject, []byte(testOrder("repl0000000000000001", "alice"))); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		st, err := rec.Replay(ctx, ReplayRange{})
+		if !errors.Is(err, context.Canceled) || st.Read != 0 {
+			t.Errorf("got %+v %v, want nothing read and %v", st, err, context.Canceled)
+		}
+	})
+
+	// Пауза между повторами — час, остановка ее прерывает.
+	t.Run("backoff", func(t *testing.T) {
+		store := &faultyStore{MemStore: repository.NewMemStore(), fails: 1, err: &pgconn.PgError{Code: "40001"}}
+		rec, src, _ := newReplayReceiver(t, store)
+		for _, uid := range []string{"repl0000000000000001", "repl0000000000000002"} {
+			if err := src.Publish(rec.cfg.StanSubject, []byte(testOrder(uid, "alice"))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		st, err := rec.Replay(ctx, ReplayRange{})
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("replay stopped in %s", elapsed)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+		if st.Read != 2 || st.Saved != 0 || st.Failed != 2 {
+			t.Errorf("got %+v, want 2 read and failed", st)
+		}
+	})
+}
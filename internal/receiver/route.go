@@ -0,0 +1,66 @@
+package receiver
+
+import (
+	"fmt"
+
+	"0lvl/internal/inspector"
+)
+
+// route — тема, на которую подписывается ресивер.
+// Версия схемы и формат заказа задаются суффиксом темы:
+//
+//	order              версия из schema_version, JSON
+//	order.2            версия 2, JSON
+//	order.msgpack      версия из schema_version, MessagePack
+//	order.2.protobuf   версия 2, Protobuf
+type route struct {
+	version  string
+	encoding inspector.Encoding
+}
+
+// newRoutes строит темы для всех версий схемы и всех включенных форматов.
+func newRoutes(schemas *inspector.Registry, encodings []string) ([]route, error) {
+	versions := append([]string{""}, schemas.Versions()...)
+	routes := make([]route, 0, len(versions)*len(encodings))
+
+	for _, name := range encodings {
+		enc, ok := inspector.ParseEncoding(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %q", name)
+		}
+		for _, version := range versions {
+			routes = append(routes, route{version: version, encoding: enc})
+		}
+	}
+	return routes, nil
+}
+
+// contentTyped — сообщение с заголовком Content-Type: JetStream, HTTP.
+type contentTyped interface {
+	ContentType() string
+}
+
+// encodingOf — формат заказа m: из Content-Type, если он есть
+// и понятен ParseEncoding, иначе формат темы. Так паблишер может
+// прислать MessagePack в основную тему, а curl со своим
+// application/x-www-form-urlencoded не ломает JSON.
+func (rt route) encodingOf(m inspector.Message) inspector.Encoding {
+	if ct, ok := m.(contentTyped); ok && ct.ContentType() != "" {
+		if enc, ok := inspector.ParseEncoding(ct.ContentType()); ok {
+			return enc
+		}
+	}
+	return rt.encoding
+}
+
+// suffix возвращает суффикс темы, части разделены sep.
+func (rt route) suffix(sep string) string {
+	var s string
+	if rt.version != "" {
+		s += sep + rt.version
+	}
+	if rt.encoding != inspector.EncodingJSON {
+		s += sep + rt.encoding.String()
+	}
+	return s
+}
@@ -0,0 +1,56 @@
+package receiver
+
+import (
+	"testing"
+
+	"0lvl/internal/inspector"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// headerMsg — сообщение JetStream с заголовками, остальное не нужно.
+type headerMsg struct {
+	jetstream.Msg
+	h nats.Header
+}
+
+func (m headerMsg) Headers() nats.Header { return m.h }
+
+func TestRoute_EncodingOf(t *testing.T) {
+	q := newQueue(SourceHTTP, nil)
+	httpMsg := func(ct string) inspector.Message {
+		m := q.newMsg("order", nil)
+		m.contentType = ct
+		return m
+	}
+	jetMsgOf := func(ct string) inspector.Message {
+		h := nats.Header{}
+		if ct != "" {
+			h.Set("Content-Type", ct)
+		}
+		return jetMsg{headerMsg{h: h}}
+	}
+
+	tests := []struct {
+		name string
+		rt   route
+		msg  inspector.Message
+		want inspector.Encoding
+	}{
+		{"http no header", route{encoding: inspector.EncodingCBOR}, httpMsg(""), inspector.EncodingCBOR},
+		{"http msgpack", route{}, httpMsg("application/msgpack"), inspector.EncodingMsgpack},
+		{"http unknown", route{encoding: inspector.EncodingMsgpack}, httpMsg("application/x-www-form-urlencoded"), inspector.EncodingMsgpack},
+		{"jetstream no header", route{encoding: inspector.EncodingProtobuf}, jetMsgOf(""), inspector.EncodingProtobuf},
+		{"jetstream cbor", route{}, jetMsgOf("application/cbor; charset=binary"), inspector.EncodingCBOR},
+		{"jetstream json", route{encoding: inspector.EncodingMsgpack}, jetMsgOf("application/json"), inspector.EncodingJSON},
+		{"stan", route{encoding: inspector.EncodingCBOR}, stanMsg{}, inspector.EncodingCBOR},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rt.encodingOf(tt.msg); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+
+	"github.com/rs/zerolog"
+)
+
+// Имена источников, они же попадают в rejected_order.source.
+const (
+	SourceStan      = "stan"
+	SourceJetStream = "jetstream"
+	SourceMemory    = "memory"
+	SourceFile      = "file"
+	SourceHTTP      = "http"
+)
+
+// Значения config.Transport.
+const (
+	transportStan      = SourceStan
+	transportJetStream = SourceJetStream
+	transportBoth      = "both"
+)
+
+var errNoPublisher = errors.New("no source can publish")
+
+// OrderSource — откуда ресивер получает заказы.
+// Проверка, накопление пакетов и сохранение одинаковы для всех источников,
+// источник только доставляет сообщения и принимает Ack/Nak/Term.
+type OrderSource interface {
+	Name() string
+
+	// Subscribe доставляет сообщения темы в handler.
+	// handler может вызываться из нескольких горутин.
+	Subscribe(subject string, opt SubOptions, handler func(inspector.Message)) (Subscription, error)
+
+	Close() error
+}
+
+// SubOptions — параметры подписки, см. Topology.
+type SubOptions struct {
+	// Durable — имя позиции чтения, общей для всех экземпляров сервиса,
+	// все подписки с одним Durable делят сообщения между собой.
+	Durable string
+	// Через сколько неподтвержденное сообщение будет доставлено снова.
+	AckWait time.Duration
+	// Сколько сообщений брокер отправит без подтверждения.
+	MaxInflight int
+}
+
+// Subscription останавливает доставку, позиция durable сохраняется.
+type Subscription interface {
+	Close() error
+}
+
+// Publisher — источник, в который можно отправить сообщение:
+// dead letter и повторная отправка отвергнутых заказов.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// newSources подключается к брокерам по cfg.Transport
+// и добавляет файл и HTTP, если они включены.
+func newSources(cfg config.Config, log zerolog.Logger) ([]OrderSource, error) {
+	var sources []OrderSource
+	fail := func(err error) ([]OrderSource, error) {
+		for _, src := range sources {
+			src.Close()
+		}
+		return nil, err
+	}
+
+	switch cfg.Transport {
+	case transportStan, transportJetStream, transportBoth:
+	default:
+		return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+
+	if cfg.Transport == transportStan || cfg.Transport == transportBoth {
+		src, err := NewStanSource(cfg, log)
+		if err != nil {
+			return fail(err)
+		}
+		sources = append(sources, src)
+	}
+
+	if cfg.Transport == transportJetStream || cfg.Transport == transportBoth {
+		src, err := NewJetStreamSource(cfg, log)
+		if err != nil {
+			return fail(err)
+		}
+		sources = append(sources, src)
+	}
+
+	if cfg.BackfillFile != "" {
+		src, err := NewFileSource(cfg.BackfillFile, cfg.StanSubject, log)
+		if err != nil {
+			return fail(err)
+		}
+		sources = append(sources, src)
+	}
+
+	if cfg.HttpPush {
+		sources = append(sources, NewHTTPSource(cfg.StanSubject))
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,125 @@
+package receiver
+
+import (
+	"context"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+
+	stan "github.com/nats-io/stan.go"
+	"github.com/rs/zerolog"
+)
+
+// StanSource читает заказы из NATS Streaming через queue группу.
+type StanSource struct {
+	conn  stan.Conn
+	queue string
+}
+
+func NewStanSource(cfg config.Config, log zerolog.Logger) (*StanSource, error) {
+	// Этот обратный вызов будет вызван, если клиент окончательно потеряет
+	// контакт с сервером (или другой клиент заменяет его во время пребывания conn.Close()).
+	connectionLost := func(_ stan.Conn, reason error) {
+		log.Error().Err(reason).Msg("stan callback error")
+	}
+	opt := stan.SetConnectionLostHandler(connectionLost)
+
+	conn, err := stan.Connect(cfg.StanClusterId, cfg.StanClientId, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &StanSource{conn: conn, queue: cfg.StanQueue}, nil
+}
+
+func (t *StanSource) Name() string {
+	return SourceStan
+}
+
+func (t *StanSource) Subscribe(subject string, opt SubOptions, handler func(inspector.Message)) (Subscription, error) {
+	return t.conn.QueueSubscribe(
+		subject,
+		t.queue,
+		func(m *stan.Msg) {
+			handler(stanMsg{m})
+		},
+		stan.DurableName(opt.Durable),
+		stan.SetManualAckMode(),
+		stan.AckWait(opt.AckWait),
+		stan.MaxInflight(opt.MaxInflight),
+	)
+}
+
+// Replay читает историю темы отдельной подпиской без durable и queue группы.
+func (t *StanSource) Replay(ctx context.Context, subject string, rng ReplayRange, handler func(inspector.Message)) error {
+	start := stan.DeliverAllAvailable()
+	switch {
+	case rng.SinceSeq > 0:
+		start = stan.StartAtSequence(rng.SinceSeq)
+	case !rng.SinceTime.IsZero():
+		start = stan.StartAtTime(rng.SinceTime)
+	}
+
+	// Обратный вызов stan только передает сообщения,
+	// handler вызывается в этой горутине.
+	msgs := make(chan *stan.Msg)
+	stop := make(chan struct{})
+	sub, err := t.conn.Subscribe(
+		subject,
+		func(m *stan.Msg) {
+			select {
+			case msgs <- m:
+			case <-stop:
+			}
+		},
+		start,
+		stan.SetManualAckMode(),
+	)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	defer close(stop)
+
+	idle := time.NewTimer(rng.idle())
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-idle.C:
+			return nil
+		case m := <-msgs:
+			if rng.past(m.Sequence, time.Unix(0, m.Timestamp)) {
+				return nil
+			}
+			handler(stanMsg{m})
+			m.Ack()
+			idle.Reset(rng.idle())
+		}
+	}
+}
+
+func (t *StanSource) Publish(subject string, data []byte) error {
+	return t.conn.Publish(subject, data)
+}
+
+func (t *StanSource) Close() error {
+	return t.conn.Close()
+}
+
+// stanMsg — в stan нет отрицательных подтверждений:
+// неподтвержденное сообщение придет снова через AckWait.
+type stanMsg struct {
+	m *stan.Msg
+}
+
+func (m stanMsg) Data() []byte         { return m.m.Data }
+func (m stanMsg) Subject() string      { return m.m.Subject }
+func (m stanMsg) Timestamp() time.Time { return time.Unix(0, m.m.Timestamp) }
+func (m stanMsg) Source() string       { return SourceStan }
+func (m stanMsg) Ack() error           { return m.m.Ack() }
+func (m stanMsg) Nak() error           { return nil }
+func (m stanMsg) Term() error          { return m.m.Ack() }
+func (m stanMsg) InProgress() error    { return nil }
@@ -0,0 +1,236 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+)
+
+// stan не принимает AckWait меньше секунды.
+const minAckWait = time.Second
+
+var (
+	// ErrBadTopology — топология не прошла проверку, текущая не изменилась.
+	ErrBadTopology = errors.New("bad topology")
+	errStopped     = errors.New("receiver stopped")
+)
+
+// Topology — сколько подписчиков и накопителей запущено
+// и с какими параметрами подписки.
+type Topology struct {
+	// Подписчиков на каждую тему каждого источника.
+	Subscribers int `json:"subscribers"`
+	// Накопителей на каждого подписчика.
+	Accumulators int `json:"accumulators"`
+	// Сколько сообщений брокер отправит без подтверждения.
+	MaxInflight int `json:"max_inflight"`
+	// Повторно заказы прилетят, если их не подтвердить за AckWaitMs.
+	// Повторы безопасны: SaveOrderBatch узнает уже сохраненные заказы
+	// по uid и хешу содержимого.
+	AckWaitMs int64 `json:"ack_wait_ms"`
+	// Имя позиции чтения, к нему добавляется суффикс темы.
+	Durable string `json:"durable"`
+}
+
+func topologyFromConfig(cfg config.Config) Topology {
+	t := Topology{
+		Subscribers:  cfg.Subscribers,
+		Accumulators: cfg.Accumulators,
+		MaxInflight:  cfg.MaxInflight,
+		AckWaitMs:    cfg.AckWait.Milliseconds(),
+		Durable:      cfg.Durable,
+	}
+	switch {
+	case t.Subscribers != 0:
+	case cfg.OrderingKey != "":
+		t.Subscribers = 1
+	default:
+		t.Subscribers = maxOf(1, runtime.NumCPU()/2)
+	}
+	return t
+}
+
+// validate проверяет топологию, ordered — включен ли config.OrderingKey.
+func (t Topology) validate(ordered bool) error {
+	switch {
+	case t.Subscribers < 1:
+		return fmt.Errorf("%w: subscribers must be at least 1, got %d", ErrBadTopology, t.Subscribers)
+	case ordered && t.Subscribers != 1:
+		// Подписчики одной группы получают сообщения вперемешку.
+		return fmt.Errorf("%w: ordering requires exactly 1 subscriber, got %d", ErrBadTopology, t.Subscribers)
+	case t.Accumulators < 1:
+		return fmt.Errorf("%w: accumulators must be at least 1, got %d", ErrBadTopology, t.Accumulators)
+	case t.MaxInflight < 1:
+		return fmt.Errorf("%w: max inflight must be at least 1, got %d", ErrBadTopology, t.MaxInflight)
+	case t.ackWait() < minAckWait:
+		return fmt.Errorf("%w: ack wait must be at least %s, got %s", ErrBadTopology, minAckWait, t.ackWait())
+	case t.Durable == "":
+		return fmt.Errorf("%w: durable name is empty", ErrBadTopology)
+	}
+	return nil
+}
+
+func (t Topology) ackWait() time.Duration {
+	return time.Duration(t.AckWaitMs) * time.Millisecond
+}
+
+func (t Topology) subOptions(rt route) SubOptions {
+	return SubOptions{
+		Durable:     t.Durable + rt.suffix(" "),
+		AckWait:     t.ackWait(),
+		MaxInflight: t.MaxInflight,
+	}
+}
+
+// generation — подписки и накопители, запущенные с одной топологией.
+// При смене топологии старое поколение останавливается целиком.
+type generation struct {
+	topo   Topology
+	subs   []Subscription
+	tuners []*tuner
+	queues []genQueue
+
+	// stop закрывается при остановке поколения:
+	// подписчики возвращают заказы Nak.
+	// quiet закрывается, когда ни один подписчик уже не пишет в очереди,
+	// тогда накопители сливают пакеты и остаток очередей, wg ждет их.
+	// Обратный вызов подписчика держит RLock на mu.
+	stop  chan struct{}
+	quiet chan struct{}
+	mu    sync.RWMutex
+	wg    sync.WaitGroup
+}
+
+// genQueue — очереди одного подписчика.
+type genQueue struct {
+	subject string
+	chs     []chan inspector.OrderBox
+}
+
+// Topology возвращает текущую топологию.
+func (r *Receiver) Topology() Topology {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen == nil {
+		return topologyFromConfig(r.cfg)
+	}
+	return r.gen.topo
+}
+
+// SetTopology перезапускает подписчиков и накопителей с новой топологией.
+// Новое поколение подписывается раньше, чем останавливается старое,
+// поэтому прием не прерывается. Если подписаться не удалось,
+// остается старая топология.
+// ctx ограничивает ожидание, пока старые накопители сольют пакеты,
+// если он истек, новая топология уже действует.
+//
+// С config.OrderingKey поколения не работают одновременно, см. restart.
+func (r *Receiver) SetTopology(ctx context.Context, t Topology) error {
+	if err := t.validate(r.cfg.OrderingKey != ""); err != nil {
+		return err
+	}
+
+	r.reconf.Lock()
+	defer r.reconf.Unlock()
+
+	select {
+	case <-r.done:
+		return errStopped
+	default:
+	}
+
+	if r.cfg.OrderingKey != "" {
+		return r.restart(t)
+	}
+
+	gen, err := r.start(t)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	old := r.gen
+	r.gen = gen
+	r.mu.Unlock()
+
+	if old == nil {
+		return nil
+	}
+	r.halt(old)
+	r.log.Info().Interface("topology", t).Msg("receiver topology changed")
+	return wait(ctx, &old.wg)
+}
+
+// restart останавливает текущее поколение и ждет, пока его накопители
+// сольют пакеты, и только потом запускает новое: иначе новое поколение
+// сохранило бы заказ раньше предыдущего заказа с тем же ключом.
+// Прием на это время прерывается, ctx ожидание не ограничивает:
+// повторы сохранения и так конечны, см. save.
+// Если новое поколение не запустилось, запускается старая топология.
+func (r *Receiver) restart(t Topology) error {
+	r.mu.Lock()
+	old := r.gen
+	r.mu.Unlock()
+
+	if old != nil {
+		r.halt(old)
+		old.wg.Wait()
+	}
+
+	gen, err := r.start(t)
+	if err != nil && old != nil {
+		var oldErr error
+		if gen, oldErr = r.start(old.topo); oldErr != nil {
+			r.log.Error().Err(oldErr).Msg("restore topology error, receiver stopped")
+		}
+	}
+
+	r.mu.Lock()
+	r.gen = gen
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		r.log.Info().Interface("topology", t).Msg("receiver topology changed")
+	}
+	return nil
+}
+
+// halt закрывает подписки поколения и останавливает его накопителей.
+func (r *Receiver) halt(gen *generation) {
+	for _, sub := range gen.subs {
+		if err := sub.Close(); err != nil {
+			r.log.Error().Err(err).Msg("subscription close error")
+		}
+	}
+	close(gen.stop)
+
+	// Дожидаемся обратных вызовов, которые уже пишут в очереди.
+	gen.mu.Lock()
+	close(gen.quiet)
+	gen.mu.Unlock()
+}
+
+// wait ждет wg, например пока накопители поколения сольют пакеты, или ctx.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
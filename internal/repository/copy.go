@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"0lvl/internal/inspector"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// trade_stage живет в сессии подключения и очищается при каждой фиксации.
+const createStageSQL = `CREATE TEMP TABLE IF NOT EXISTS trade_stage (
+		idx     INTEGER,
+		pk      VARCHAR(32),
+		rang    BIGINT,
+		entity  BYTEA,
+		hash    BYTEA
+	) ON COMMIT DELETE ROWS;`
+
+// copyUpsertSQL — upsertSQL для всего trade_stage одним запросом.
+// Из заказов с одним uid в пакете вставляется первый,
+// остальные сравниваются с ним, как с уже сохраненным.
+// Подзапрос к trade видит таблицу до вставки из ins,
+// uid от параллельной транзакции получает upsertUnseen.
+const copyUpsertSQL = `WITH ins AS (
+		INSERT INTO trade (pk, rang, entity, hash)
+		SELECT DISTINCT ON (pk) pk, rang, entity, hash FROM trade_stage ORDER BY pk, idx
+		ON CONFLICT (pk) DO NOTHING
+		RETURNING pk
+	), first AS (
+		SELECT DISTINCT ON (pk) pk, idx, hash FROM trade_stage ORDER BY pk, idx
+	)
+	SELECT s.idx, CASE
+		WHEN ins.pk IS NOT NULL AND s.idx = f.idx THEN 0
+		WHEN ins.pk IS NULL AND t.pk IS NULL THEN 3
+		WHEN coalesce(t.hash = s.hash, t.entity = s.entity, f.hash = s.hash) THEN 1
+		ELSE 2
+	END
+	FROM trade_stage s
+	JOIN first f ON f.pk = s.pk
+	LEFT JOIN ins ON ins.pk = s.pk
+	LEFT JOIN trade t ON t.pk = s.pk;`
+
+var stageColumns = []string{"idx", "pk", "rang", "entity", "hash"}
+
+// saveCopy сохраняет пакет через COPY во временную таблицу
+// и один INSERT ... SELECT, итог каждого заказа как в upsertSQL.
+// Строки нормализованных таблиц для orders, если они есть, тоже идут через COPY.
+// Все выполняется в одной транзакции, ошибка относится ко всему пакету.
+func (s *PgStore) saveCopy(ctx context.Context, batch []*inspector.OrderBox, orders []*Order) ([]int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createStageSQL); err != nil {
+		return nil, err
+	}
+
+	rows := pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+		box := batch[i]
+		hash := sha256.Sum256(box.Data)
+		return []any{int32(i), box.Uid, box.Rang, box.Data, hash[:]}, nil
+	})
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"trade_stage"}, stageColumns, rows); err != nil {
+		return nil, err
+	}
+
+	status := make([]int, len(batch))
+	seen := 0
+	res, err := tx.Query(ctx, copyUpsertSQL)
+	if err != nil {
+		return nil, err
+	}
+	for res.Next() {
+		var idx, st int
+		if err := res.Scan(&idx, &st); err != nil {
+			res.Close()
+			return nil, err
+		}
+		status[idx] = st
+		seen++
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	if seen != len(batch) {
+		return nil, fmt.Errorf("copy upsert returned %d rows for %d orders", seen, len(batch))
+	}
+
+	if orders != nil {
+		if err := copyNormal(ctx, tx, orders, status); err != nil {
+			return nil, err
+		}
+	}
+	return status, tx.Commit(ctx)
+}
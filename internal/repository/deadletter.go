@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"0lvl/internal/inspector"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Причины, по которым заказ попал в rejected_order.
+const (
+	// Заказ не прошел проверку инспектора.
+	ReasonRejected = "rejected"
+	// Заказ не удалось сохранить.
+	ReasonFailed = "failed"
+	// Заказ с таким uid уже сохранен с другим содержимым.
+	ReasonConflict = "conflict"
+)
+
+// RejectedOrder — заказ, который не попал в trade.
+// Payload хранится как пришел из NATS, до перевода в JSON,
+// чтобы его можно было отправить повторно в ту же тему.
+type RejectedOrder struct {
+	Id          int64                        `json:"id"`
+	Reason      string                       `json:"reason"`
+	Source      string                       `json:"source"`
+	Subject     string                       `json:"subject"`
+	Uid         string                       `json:"order_uid,omitempty"`
+	Version     string                       `json:"schema_version,omitempty"`
+	Error       string                       `json:"error"`
+	Errors      []*inspector.ValidationError `json:"errors,omitempty"`
+	Payload     []byte                       `json:"payload,omitempty"`
+	ReceivedAt  time.Time                    `json:"received_at"`
+	CreatedAt   time.Time                    `json:"created_at"`
+	Resubmitted *time.Time                   `json:"resubmitted_at,omitempty"`
+}
+
+// NewRejectedOrder собирает запись из отвергнутого box.
+func NewRejectedOrder(box *inspector.OrderBox, reason string) RejectedOrder {
+	rec := RejectedOrder{
+		Reason:  reason,
+		Uid:     box.Uid,
+		Version: box.Version,
+		Errors:  inspector.Errors(box.Err),
+		Payload: box.Data,
+	}
+	if box.Err != nil {
+		rec.Error = box.Err.Error()
+	}
+	if box.Msg != nil {
+		rec.Source = box.Msg.Source()
+		rec.Subject = box.Msg.Subject()
+		rec.Payload = box.Msg.Data()
+		rec.ReceivedAt = box.Msg.Timestamp()
+	}
+	return rec
+}
+
+// SaveRejected сохраняет заказ в rejected_order.
+func (r *Repo) SaveRejected(rec RejectedOrder) error {
+	return r.store.SaveRejected(context.Background(), rec)
+}
+
+// RejectedOrders возвращает последние отвергнутые заказы без payload,
+// before — id, с которого продолжить, 0 — с самого нового.
+func (r *Repo) RejectedOrders(limit int, before int64) ([]RejectedOrder, error) {
+	return r.store.RejectedOrders(context.Background(), limit, before)
+}
+
+// RejectedOrder возвращает отвергнутый заказ вместе с payload,
+// ErrNotFound — записи с таким id нет.
+func (r *Repo) RejectedOrder(id int64) (RejectedOrder, error) {
+	return r.store.RejectedOrder(context.Background(), id)
+}
+
+// MarkResubmitted отмечает время повторной отправки.
+func (r *Repo) MarkResubmitted(id int64) error {
+	return r.store.MarkResubmitted(context.Background(), id)
+}
+
+func (s *PgStore) SaveRejected(ctx context.Context, rec RejectedOrder) error {
+	errs, err := json.Marshal(rec.Errors)
+	if err != nil {
+		return err
+	}
+
+	const sql = `INSERT INTO rejected_order (reason, source, subject, order_uid, schema_version, error, errors, payload, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+	_, err = s.db.Exec(ctx, sql,
+		rec.Reason, rec.Source, rec.Subject, rec.Uid, rec.Version, rec.Error, errs, rec.Payload, rec.ReceivedAt)
+	return err
+}
+
+func (s *PgStore) RejectedOrders(ctx context.Context, limit int, before int64) ([]RejectedOrder, error) {
+	const sql = `SELECT id, reason, source, subject, order_uid, schema_version, error, errors, received_at, created_at, resubmitted_at
+		FROM rejected_order WHERE $2 = 0 OR id < $2 ORDER BY id DESC LIMIT $1;`
+
+	rows, err := s.db.Query(ctx, sql, limit, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recs := make([]RejectedOrder, 0, limit)
+	for rows.Next() {
+		var rec RejectedOrder
+		if err := scanRejected(rows, &rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+func (s *PgStore) RejectedOrder(ctx context.Context, id int64) (RejectedOrder, error) {
+	const sql = `SELECT id, reason, source, subject, order_uid, schema_version, error, errors, received_at, created_at, resubmitted_at, payload
+		FROM rejected_order WHERE id = $1;`
+
+	var rec RejectedOrder
+	err := scanRejected(s.db.QueryRow(ctx, sql, id), &rec, &rec.Payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rec, ErrNotFound
+	}
+	return rec, err
+}
+
+func (s *PgStore) MarkResubmitted(ctx context.Context, id int64) error {
+	const sql = `UPDATE rejected_order SET resubmitted_at = now() WHERE id = $1;`
+	_, err := s.db.Exec(ctx, sql, id)
+	return err
+}
+
+func scanRejected(row pgx.Row, rec *RejectedOrder, extra ...any) error {
+	var errs []byte
+	dest := append([]any{
+		&rec.Id, &rec.Reason, &rec.Source, &rec.Subject, &rec.Uid, &rec.Version,
+		&rec.Error, &errs, &rec.ReceivedAt, &rec.CreatedAt, &rec.Resubmitted,
+	}, extra...)
+
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	return json.Unmarshal(errs, &rec.Errors)
+}
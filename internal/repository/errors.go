@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrBatchAborted — заказ сам по себе в порядке, но пакет откатился
+	// из-за ошибки другого заказа, его нужно сохранить заново.
+	ErrBatchAborted = errors.New("batch aborted by another order")
+	// ErrDuplicate — точно такой же заказ уже сохранен.
+	ErrDuplicate = errors.New("order already saved")
+	// ErrConflict — заказ с таким uid уже сохранен с другим содержимым.
+	ErrConflict = errors.New("order uid saved with different content")
+	// ErrUnseen — заказ с таким uid вставила параллельная транзакция,
+	// но сравнить с ним не вышло: запрос его еще не видит.
+	ErrUnseen = errors.New("order uid inserted concurrently")
+)
+
+// tradeTable — таблица, дубль ключа которой значит повтор заказа.
+const tradeTable = "trade"
+
+// ErrorClass — что делать с заказом после ошибки сохранения.
+type ErrorClass int
+
+const (
+	// Ошибки нет, заказ сохранен.
+	ErrorNone ErrorClass = iota
+	// Такой же заказ уже есть в базе.
+	ErrorDuplicate
+	// Заказ с таким uid, но другим содержимым уже есть в базе.
+	ErrorConflict
+	// База не примет заказ, сколько ни повторяй.
+	ErrorPermanent
+	// Соединение, таймаут, перегрузка базы: стоит повторить.
+	ErrorTransient
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorNone:
+		return "none"
+	case ErrorDuplicate:
+		return "duplicate"
+	case ErrorConflict:
+		return "conflict"
+	case ErrorPermanent:
+		return "permanent"
+	}
+	return "transient"
+}
+
+// Classify определяет класс ошибки SaveOrderBatch.
+// Неизвестные ошибки без кода Postgres считаются временными:
+// лучше получить заказ повторно, чем потерять.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ErrorNone
+	}
+	switch {
+	case errors.Is(err, ErrBatchAborted), errors.Is(err, ErrUnseen):
+		return ErrorTransient
+	case errors.Is(err, ErrDuplicate):
+		return ErrorDuplicate
+	case errors.Is(err, ErrConflict):
+		return ErrorConflict
+	case errors.Is(err, ErrMalformed):
+		return ErrorPermanent
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Дубль ключа в другой таблице — не повтор заказа,
+		// а ошибка в его содержимом.
+		if pgErr.Code == "23505" && pgErr.TableName != tradeTable {
+			return ErrorPermanent
+		}
+		return classifyCode(pgErr.Code)
+	}
+
+	// Обрыв соединения, таймаут, закрытый пул.
+	return ErrorTransient
+}
+
+// classifyCode разбирает SQLSTATE,
+// см. https://www.postgresql.org/docs/current/errcodes-appendix.html
+func classifyCode(code string) ErrorClass {
+	switch code {
+	case "23505": // unique_violation в trade, содержимое не сравнивалось
+		return ErrorDuplicate
+	case "25P02": // in_failed_sql_transaction
+		return ErrorTransient
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return ErrorTransient
+	case "57014", "57P01", "57P02", "57P03": // query_canceled, admin_shutdown, crash_shutdown, cannot_connect_now
+		return ErrorTransient
+	}
+
+	switch {
+	case strings.HasPrefix(code, "08"): // connection_exception
+		return ErrorTransient
+	case strings.HasPrefix(code, "53"): // insufficient_resources
+		return ErrorTransient
+	case strings.HasPrefix(code, "58"): // system_error
+		return ErrorTransient
+	}
+	return ErrorPermanent
+}
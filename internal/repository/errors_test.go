@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"none", nil, ErrorNone},
+		{"aborted", ErrBatchAborted, ErrorTransient},
+		{"unseen", ErrUnseen, ErrorTransient},
+		{"duplicate", ErrDuplicate, ErrorDuplicate},
+		{"conflict", fmt.Errorf("save: %w", ErrConflict), ErrorConflict},
+		{"malformed", ErrMalformed, ErrorPermanent},
+		{"trade unique", &pgconn.PgError{Code: "23505", TableName: "trade", ConstraintName: "trade_pkey"}, ErrorDuplicate},
+		{"other unique", &pgconn.PgError{Code: "23505", TableName: "item", ConstraintName: "item_pkey"}, ErrorPermanent},
+		{"unique without table", &pgconn.PgError{Code: "23505"}, ErrorPermanent},
+		{"serialization", &pgconn.PgError{Code: "40001"}, ErrorTransient},
+		{"connection", &pgconn.PgError{Code: "08006"}, ErrorTransient},
+		{"too long", &pgconn.PgError{Code: "22001"}, ErrorPermanent},
+		{"network", errors.New("conn reset"), ErrorTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"0lvl/internal/inspector"
+)
+
+// MemStore — OrderStore в памяти процесса.
+// Повторы и конфликты различает так же, как PgStore,
+// нормализованных таблиц нет. Все теряется при остановке.
+type MemStore struct {
+	mu       sync.RWMutex
+	orders   map[string]StoredOrder
+	rejected []RejectedOrder // id = индекс + 1
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{orders: make(map[string]StoredOrder)}
+}
+
+func (s *MemStore) SaveOrderBatch(ctx context.Context, batch []*inspector.OrderBox) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, box := range batch {
+		if o, ok := s.orders[box.Uid]; ok {
+			if bytes.Equal(o.Data, box.Data) {
+				box.Err = ErrDuplicate
+			} else {
+				box.Err = ErrConflict
+			}
+			continue
+		}
+		s.orders[box.Uid] = StoredOrder{
+			Uid:  box.Uid,
+			Rang: box.Rang,
+			Data: bytes.Clone(box.Data),
+		}
+	}
+}
+
+func (s *MemStore) Order(ctx context.Context, uid string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(o.Data), nil
+}
+
+func (s *MemStore) Recent(ctx context.Context, count int) ([]StoredOrder, error) {
+	orders := s.sorted()
+	if len(orders) > count {
+		orders = orders[:count]
+	}
+	for i := range orders {
+		orders[i].Data = nil
+	}
+	return orders, nil
+}
+
+func (s *MemStore) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.orders), nil
+}
+
+func (s *MemStore) Scan(ctx context.Context, fn func(o StoredOrder) bool) error {
+	for _, o := range s.sorted() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(o) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// sorted возвращает снимок заказов от свежих к старым.
+func (s *MemStore) sorted() []StoredOrder {
+	s.mu.RLock()
+	orders := make([]StoredOrder, 0, len(s.orders))
+	for _, o := range s.orders {
+		orders = append(orders, o)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].Rang != orders[j].Rang {
+			return orders[i].Rang > orders[j].Rang
+		}
+		return orders[i].Uid < orders[j].Uid
+	})
+	return orders
+}
+
+func (s *MemStore) SaveRejected(ctx context.Context, rec RejectedOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.Id = int64(len(s.rejected) + 1)
+	rec.CreatedAt = time.Now()
+	rec.Resubmitted = nil
+	rec.Payload = bytes.Clone(rec.Payload)
+	s.rejected = append(s.rejected, rec)
+	return nil
+}
+
+func (s *MemStore) RejectedOrders(ctx context.Context, limit int, before int64) ([]RejectedOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := len(s.rejected)
+	if before > 0 && before-1 < int64(i) {
+		i = int(before - 1)
+	}
+	recs := make([]RejectedOrder, 0, limit)
+	for i--; i >= 0 && len(recs) < limit; i-- {
+		rec := s.rejected[i]
+		rec.Payload = nil
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func (s *MemStore) RejectedOrder(ctx context.Context, id int64) (RejectedOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id < 1 || id > int64(len(s.rejected)) {
+		return RejectedOrder{}, ErrNotFound
+	}
+	rec := s.rejected[id-1]
+	rec.Payload = bytes.Clone(rec.Payload)
+	return rec, nil
+}
+
+func (s *MemStore) MarkResubmitted(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > int64(len(s.rejected)) {
+		return ErrNotFound
+	}
+	now := time.Now()
+	s.rejected[id-1].Resubmitted = &now
+	return nil
+}
+
+func (s *MemStore) Close() {}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	// ErrNotMigrated — в базе применены не все миграции,
+	// сервис с такой базой не работает.
+	ErrNotMigrated = errors.New("database is not migrated")
+	// ErrUnknownMigration — в базе применены миграции новее этой сборки:
+	// схема уже не та, под которую она написана.
+	ErrUnknownMigration = errors.New("database has migrations unknown to this build")
+)
+
+// Migration — шаг схемы базы из migrations/NNNN_name.up.sql
+// и парного NNNN_name.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+
+	up, down string
+}
+
+// MigrationStatus — миграция и время ее применения,
+// нулевое — не применена. Unknown — версия есть только в базе,
+// ее применила сборка новее этой, Name пустое.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+	Unknown   bool
+}
+
+func (s MigrationStatus) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// Migrations — встроенные миграции по возрастанию версии.
+var Migrations = mustLoadMigrations(migrationFiles)
+
+// Ключ pg_advisory_xact_lock: миграции из двух процессов
+// выполняются по очереди.
+const migrationLock = 0x6f72646572
+
+const createMigrationsSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     INTEGER PRIMARY KEY,
+		name        TEXT NOT NULL,
+		applied_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`
+
+func mustLoadMigrations(fsys fs.FS) []Migration {
+	ms, err := loadMigrations(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return ms
+}
+
+// loadMigrations читает migrations/*.sql. Версии идут подряд с 1,
+// у каждой есть up и down.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+		base, dir := cutLast(base, ".")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version < 1 || (dir != "up" && dir != "down") {
+			return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d: names %s and %s differ", version, m.Name, name)
+		}
+		if dir == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: both up and down are required", m.Version, m.Name)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return ms, nil
+}
+
+func cutLast(s, sep string) (string, string) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+len(sep):]
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrateUp применяет все непримененные миграции по порядку,
+// каждую в своей транзакции. Возвращает примененные,
+// при ошибке — те, что успели примениться до нее.
+func (s *PgStore) MigrateUp(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	for _, m := range Migrations {
+		ok, err := s.migrate(ctx, m, true)
+		if err != nil {
+			return done, fmt.Errorf("migration %s up: %w", m, err)
+		}
+		if ok {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown откатывает steps последних примененных миграций.
+func (s *PgStore) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	for i := len(Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := Migrations[i]
+		ok, err := s.migrate(ctx, m, false)
+		if err != nil {
+			return done, fmt.Errorf("migration %s down: %w", m, err)
+		}
+		if ok {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// migrate применяет или откатывает m, false — делать нечего.
+func (s *PgStore) migrate(ctx context.Context, m Migration, up bool) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1);`, migrationLock); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, createMigrationsSQL); err != nil {
+		return false, err
+	}
+
+	var applied bool
+	const sql = `SELECT EXISTS (SELECT FROM schema_migrations WHERE version = $1);`
+	if err := tx.QueryRow(ctx, sql, m.Version).Scan(&applied); err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, m.up)
+	} else {
+		_, err = tx.Exec(ctx, m.down)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1;`, m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// MigrationStatus возвращает все встроенные миграции
+// с отметкой о применении, за ними — неизвестные этой сборке
+// версии из базы по возрастанию. База не меняется.
+func (s *PgStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	status := make([]MigrationStatus, len(Migrations))
+	for i, m := range Migrations {
+		status[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // undefined_table
+			return status, nil
+		}
+		return nil, err
+	}
+
+	var version int
+	var at time.Time
+	var unknown []MigrationStatus
+	_, err = pgx.ForEachRow(rows, []any{&version, &at}, func() error {
+		if version >= 1 && version <= len(Migrations) {
+			status[version-1].AppliedAt = at
+		} else {
+			unknown = append(unknown, MigrationStatus{Version: version, AppliedAt: at, Unknown: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return append(status, unknown...), nil
+}
+
+// CheckMigrations возвращает ErrNotMigrated,
+// если в базе применены не все встроенные миграции,
+// и ErrUnknownMigration, если в ней есть миграции новее этой сборки.
+func (s *PgStore) CheckMigrations(ctx context.Context) error {
+	status, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	return checkStatus(status)
+}
+
+func checkStatus(status []MigrationStatus) error {
+	var pending, unknown []string
+	for _, st := range status {
+		switch {
+		case st.Unknown:
+			unknown = append(unknown, fmt.Sprintf("%04d", st.Version))
+		case !st.Applied():
+			pending = append(pending, fmt.Sprintf("%04d_%s", st.Version, st.Name))
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: applied %s, run a newer build or roll them back with it", ErrUnknownMigration, strings.Join(unknown, ", "))
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending %s, run orderstorage migrate up", ErrNotMigrated, strings.Join(pending, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMigrations(t *testing.T) {
+	if len(Migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range Migrations {
+		if m.Version != i+1 || m.up == "" || m.down == "" {
+			t.Errorf("bad migration %s", m)
+		}
+	}
+	// Откат trade потерял бы все заказы.
+	if !strings.Contains(Migrations[0].down, "RAISE EXCEPTION") {
+		t.Errorf("migration %s down must refuse", Migrations[0])
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	at := time.Now()
+	applied := MigrationStatus{Version: 1, Name: "a", AppliedAt: at}
+	pending := MigrationStatus{Version: 2, Name: "b"}
+	unknown := MigrationStatus{Version: 3, AppliedAt: at, Unknown: true}
+
+	for _, tc := range []struct {
+		name   string
+		status []MigrationStatus
+		want   error
+	}{
+		{"applied", []MigrationStatus{applied}, nil},
+		{"pending", []MigrationStatus{applied, pending}, ErrNotMigrated},
+		{"unknown", []MigrationStatus{applied, unknown}, ErrUnknownMigration},
+		{"pending and unknown", []MigrationStatus{applied, pending, unknown}, ErrUnknownMigration},
+	} {
+		if err := checkStatus(tc.status); !errors.Is(err, tc.want) || tc.want == nil && err != nil {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	for _, tc := range []struct {
+		name  string
+		files []string
+	}{
+		{"no down", []string{"0001_a.up.sql"}},
+		{"gap", []string{"0001_a.up.sql", "0001_a.down.sql", "0003_c.up.sql", "0003_c.down.sql"}},
+		{"name", []string{"0001_a.up.sql", "0001_b.down.sql"}},
+		{"direction", []string{"0001_a.sql"}},
+		{"version", []string{"a_a.up.sql", "a_a.down.sql"}},
+	} {
+		fsys := fstest.MapFS{}
+		for _, f := range tc.files {
+			fsys["migrations/"+f] = file
+		}
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+
+	ms, err := loadMigrations(fstest.MapFS{
+		"migrations/0002_b.up.sql":     file,
+		"migrations/0002_b.down.sql":   file,
+		"migrations/0001_a_b.up.sql":   file,
+		"migrations/0001_a_b.down.sql": file,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].String() != "0001_a_b" || ms[1].String() != "0002_b" {
+		t.Errorf("got %v", ms)
+	}
+}
@@ -0,0 +1,6 @@
+-- trade — единственная копия заказов, откат ее не удаляет.
+DO $$
+BEGIN
+    RAISE EXCEPTION 'migration 0001_trade is irreversible: trade holds the only copy of orders';
+END
+$$;
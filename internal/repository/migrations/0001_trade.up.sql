@@ -0,0 +1,7 @@
+-- Заказы целиком, pk — order_uid.
+-- IF NOT EXISTS: базы, созданные до миграций, принимают ее как есть.
+CREATE TABLE IF NOT EXISTS trade (
+    pk      VARCHAR(32) PRIMARY KEY,
+    rang    BIGINT,
+    entity  BYTEA
+);
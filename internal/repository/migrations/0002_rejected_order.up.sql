@@ -0,0 +1,15 @@
+-- Заказы, которые не прошли проверку или не сохранились.
+CREATE TABLE IF NOT EXISTS rejected_order (
+    id              BIGSERIAL PRIMARY KEY,
+    reason          VARCHAR(16) NOT NULL,
+    source          VARCHAR(16) NOT NULL,
+    subject         TEXT NOT NULL,
+    order_uid       TEXT NOT NULL,
+    schema_version  TEXT NOT NULL,
+    error           TEXT NOT NULL,
+    errors          JSONB,
+    payload         BYTEA NOT NULL,
+    received_at     TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resubmitted_at  TIMESTAMPTZ
+);
@@ -0,0 +1 @@
+ALTER TABLE trade DROP COLUMN hash;
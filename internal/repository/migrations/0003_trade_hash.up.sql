@@ -0,0 +1,2 @@
+-- Хеш содержимого заказа, по нему SaveOrderBatch отличает повтор от конфликта.
+ALTER TABLE trade ADD COLUMN IF NOT EXISTS hash BYTEA;
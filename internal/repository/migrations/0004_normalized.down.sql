@@ -0,0 +1,4 @@
+DROP TABLE item;
+DROP TABLE payment;
+DROP TABLE delivery;
+DROP TABLE "order";
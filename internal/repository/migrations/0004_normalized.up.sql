@@ -0,0 +1,62 @@
+-- Нормализованные таблицы заказа, снимок internal/schema/order.sql.
+-- Изменения order.json требуют новой миграции, эту не править.
+
+CREATE TABLE "order" (
+    order_uid TEXT PRIMARY KEY REFERENCES trade (pk) ON DELETE CASCADE,
+    track_number TEXT NOT NULL,
+    entry TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    internal_signature TEXT NOT NULL,
+    customer_id TEXT NOT NULL,
+    delivery_service TEXT NOT NULL,
+    shardkey TEXT NOT NULL,
+    sm_id BIGINT NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard TEXT NOT NULL
+);
+
+CREATE TABLE "delivery" (
+    order_uid TEXT PRIMARY KEY REFERENCES "order" ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL,
+    zip TEXT NOT NULL,
+    city TEXT NOT NULL,
+    address TEXT NOT NULL,
+    region TEXT NOT NULL,
+    email TEXT NOT NULL
+);
+
+CREATE TABLE "payment" (
+    order_uid TEXT PRIMARY KEY REFERENCES "order" ON DELETE CASCADE,
+    transaction TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    payment_dt BIGINT NOT NULL,
+    bank TEXT NOT NULL,
+    delivery_cost BIGINT NOT NULL,
+    goods_total BIGINT NOT NULL,
+    custom_fee BIGINT NOT NULL
+);
+
+CREATE TABLE "item" (
+    order_uid TEXT NOT NULL REFERENCES "order" ON DELETE CASCADE,
+    idx INTEGER NOT NULL,
+    chrt_id BIGINT NOT NULL,
+    track_number TEXT NOT NULL,
+    price BIGINT NOT NULL,
+    rid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    sale BIGINT NOT NULL,
+    size TEXT NOT NULL,
+    total_price BIGINT NOT NULL,
+    nm_id BIGINT NOT NULL,
+    brand TEXT NOT NULL,
+    status BIGINT NOT NULL,
+    PRIMARY KEY (order_uid, idx)
+);
+
+CREATE INDEX payment_provider_idx ON "payment" (provider);
+CREATE INDEX item_chrt_id_idx ON "item" (chrt_id);
+CREATE INDEX item_nm_id_idx ON "item" (nm_id);
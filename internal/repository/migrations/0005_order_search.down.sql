@@ -0,0 +1,5 @@
+-- Строки, разложенные из trade, остаются: их не отличить от новых.
+DROP INDEX order_track_number_idx;
+DROP INDEX order_customer_id_idx;
+DROP INDEX order_date_created_idx;
+DROP INDEX delivery_phone_idx;
@@ -0,0 +1,69 @@
+-- Индексы поиска заказов, см. OrderStore.Search.
+CREATE INDEX order_track_number_idx ON "order" (track_number);
+CREATE INDEX order_customer_id_idx ON "order" (customer_id);
+CREATE INDEX order_date_created_idx ON "order" (date_created);
+CREATE INDEX delivery_phone_idx ON "delivery" (phone);
+
+-- Заказы, сохраненные до нормализованных таблиц, раскладываются из trade.
+-- Поля, убранные из заказа при сохранении (DROP_FIELDS), становятся пустыми.
+CREATE TEMP TABLE backfill ON COMMIT DROP AS
+SELECT t.pk, convert_from(t.entity, 'UTF8')::jsonb AS j
+FROM trade t
+WHERE NOT EXISTS (SELECT FROM "order" o WHERE o.order_uid = t.pk);
+
+INSERT INTO "order" (order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard)
+SELECT pk,
+    coalesce(j->>'track_number', ''),
+    coalesce(j->>'entry', ''),
+    coalesce(j->>'locale', ''),
+    coalesce(j->>'internal_signature', ''),
+    coalesce(j->>'customer_id', ''),
+    coalesce(j->>'delivery_service', ''),
+    coalesce(j->>'shardkey', ''),
+    coalesce((j->>'sm_id')::numeric, 0)::bigint,
+    (j->>'date_created')::timestamptz,
+    coalesce(j->>'oof_shard', '')
+FROM backfill;
+
+INSERT INTO "delivery" (order_uid, name, phone, zip, city, address, region, email)
+SELECT pk,
+    coalesce(j#>>'{delivery,name}', ''),
+    coalesce(j#>>'{delivery,phone}', ''),
+    coalesce(j#>>'{delivery,zip}', ''),
+    coalesce(j#>>'{delivery,city}', ''),
+    coalesce(j#>>'{delivery,address}', ''),
+    coalesce(j#>>'{delivery,region}', ''),
+    coalesce(j#>>'{delivery,email}', '')
+FROM backfill;
+
+INSERT INTO "payment" (order_uid, transaction, request_id, currency, provider, amount,
+    payment_dt, bank, delivery_cost, goods_total, custom_fee)
+SELECT pk,
+    coalesce(j#>>'{payment,transaction}', ''),
+    coalesce(j#>>'{payment,request_id}', ''),
+    coalesce(j#>>'{payment,currency}', ''),
+    coalesce(j#>>'{payment,provider}', ''),
+    coalesce((j#>>'{payment,amount}')::numeric, 0)::bigint,
+    coalesce((j#>>'{payment,payment_dt}')::numeric, 0)::bigint,
+    coalesce(j#>>'{payment,bank}', ''),
+    coalesce((j#>>'{payment,delivery_cost}')::numeric, 0)::bigint,
+    coalesce((j#>>'{payment,goods_total}')::numeric, 0)::bigint,
+    coalesce((j#>>'{payment,custom_fee}')::numeric, 0)::bigint
+FROM backfill;
+
+INSERT INTO "item" (order_uid, idx, chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status)
+SELECT b.pk, i.n - 1,
+    coalesce((i.v->>'chrt_id')::numeric, 0)::bigint,
+    coalesce(i.v->>'track_number', ''),
+    coalesce((i.v->>'price')::numeric, 0)::bigint,
+    coalesce(i.v->>'rid', ''),
+    coalesce(i.v->>'name', ''),
+    coalesce((i.v->>'sale')::numeric, 0)::bigint,
+    coalesce(i.v->>'size', ''),
+    coalesce((i.v->>'total_price')::numeric, 0)::bigint,
+    coalesce((i.v->>'nm_id')::numeric, 0)::bigint,
+    coalesce(i.v->>'brand', ''),
+    coalesce((i.v->>'status')::numeric, 0)::bigint
+FROM backfill b, jsonb_array_elements(b.j->'items') WITH ORDINALITY AS i(v, n);
@@ -0,0 +1 @@
+DROP TABLE normalize_backfill;
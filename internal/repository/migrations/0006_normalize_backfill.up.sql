@@ -0,0 +1,8 @@
+-- Докуда PgStore.Backfill разложил trade по нормализованным таблицам.
+-- Одна строка: last_pk — последний просмотренный заказ, done — trade пройдена целиком.
+CREATE TABLE normalize_backfill (
+    id       BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_pk  VARCHAR(32) NOT NULL DEFAULT '',
+    done     BOOLEAN NOT NULL DEFAULT FALSE
+);
+INSERT INTO normalize_backfill DEFAULT VALUES;
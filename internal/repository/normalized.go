@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"0lvl/internal/inspector"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrMalformed — заказ прошел инспектор, но не ложится в таблицы.
+// Инспектор пропускает только целые числа, так что это страховка
+// на случай схемы, разошедшейся с таблицами.
+var ErrMalformed = errors.New("order does not fit normalized tables")
+
+// normalSQL — INSERT одной строки в каждую таблицу normalTables.
+var normalSQL = func() map[string]string {
+	m := make(map[string]string, len(normalTables))
+	for _, t := range normalTables {
+		cols := normalColumns[t]
+		args := make([]string, len(cols))
+		for i := range cols {
+			args[i] = fmt.Sprintf("$%d", i+1)
+		}
+		m[t] = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+			pgx.Identifier{t}.Sanitize(), strings.Join(cols, ", "), strings.Join(args, ", "))
+	}
+	return m
+}()
+
+// backfillBatch — сколько заказов trade Backfill просматривает
+// в одной транзакции.
+const backfillBatch = 1000
+
+// backfillSQL раскладывает по нормализованным таблицам заказы trade
+// после $1, не больше $2, которых в них нет: сохраненные с выключенным
+// config.Normalize. Поля, убранные из заказа при сохранении
+// (DROP_FIELDS), становятся пустыми. Итог — последний просмотренный
+// pk (NULL, если trade кончилась) и число разложенных заказов.
+// Внешние ключи проверяются в конце запроса, так что порядок
+// вставок в CTE не важен.
+const backfillSQL = `WITH page AS (
+		SELECT pk, entity FROM trade WHERE pk > $1 ORDER BY pk LIMIT $2
+	), b AS (
+		SELECT p.pk, convert_from(p.entity, 'UTF8')::jsonb AS j
+		FROM page p
+		WHERE NOT EXISTS (SELECT FROM "order" o WHERE o.order_uid = p.pk)
+	), o AS (
+		INSERT INTO "order" (order_uid, track_number, entry, locale, internal_signature, customer_id,
+		    delivery_service, shardkey, sm_id, date_created, oof_shard)
+		SELECT pk,
+		    coalesce(j->>'track_number', ''),
+		    coalesce(j->>'entry', ''),
+		    coalesce(j->>'locale', ''),
+		    coalesce(j->>'internal_signature', ''),
+		    coalesce(j->>'customer_id', ''),
+		    coalesce(j->>'delivery_service', ''),
+		    coalesce(j->>'shardkey', ''),
+		    coalesce((j->>'sm_id')::numeric, 0)::bigint,
+		    (j->>'date_created')::timestamptz,
+		    coalesce(j->>'oof_shard', '')
+		FROM b
+	), d AS (
+		INSERT INTO "delivery" (order_uid, name, phone, zip, city, address, region, email)
+		SELECT pk,
+		    coalesce(j#>>'{delivery,name}', ''),
+		    coalesce(j#>>'{delivery,phone}', ''),
+		    coalesce(j#>>'{delivery,zip}', ''),
+		    coalesce(j#>>'{delivery,city}', ''),
+		    coalesce(j#>>'{delivery,address}', ''),
+		    coalesce(j#>>'{delivery,region}', ''),
+		    coalesce(j#>>'{delivery,email}', '')
+		FROM b
+	), pay AS (
+		INSERT INTO "payment" (order_uid, transaction, request_id, currency, provider, amount,
+		    payment_dt, bank, delivery_cost, goods_total, custom_fee)
+		SELECT pk,
+		    coalesce(j#>>'{payment,transaction}', ''),
+		    coalesce(j#>>'{payment,request_id}', ''),
+		    coalesce(j#>>'{payment,currency}', ''),
+		    coalesce(j#>>'{payment,provider}', ''),
+		    coalesce((j#>>'{payment,amount}')::numeric, 0)::bigint,
+		    coalesce((j#>>'{payment,payment_dt}')::numeric, 0)::bigint,
+		    coalesce(j#>>'{payment,bank}', ''),
+		    coalesce((j#>>'{payment,delivery_cost}')::numeric, 0)::bigint,
+		    coalesce((j#>>'{payment,goods_total}')::numeric, 0)::bigint,
+		    coalesce((j#>>'{payment,custom_fee}')::numeric, 0)::bigint
+		FROM b
+	), it AS (
+		INSERT INTO "item" (order_uid, idx, chrt_id, track_number, price, rid, name, sale, size,
+		    total_price, nm_id, brand, status)
+		SELECT b.pk, i.n - 1,
+		    coalesce((i.v->>'chrt_id')::numeric, 0)::bigint,
+		    coalesce(i.v->>'track_number', ''),
+		    coalesce((i.v->>'price')::numeric, 0)::bigint,
+		    coalesce(i.v->>'rid', ''),
+		    coalesce(i.v->>'name', ''),
+		    coalesce((i.v->>'sale')::numeric, 0)::bigint,
+		    coalesce(i.v->>'size', ''),
+		    coalesce((i.v->>'total_price')::numeric, 0)::bigint,
+		    coalesce((i.v->>'nm_id')::numeric, 0)::bigint,
+		    coalesce(i.v->>'brand', ''),
+		    coalesce((i.v->>'status')::numeric, 0)::bigint
+		FROM b, jsonb_array_elements(b.j->'items') WITH ORDINALITY AS i(v, n)
+	)
+	SELECT (SELECT max(pk) FROM page), (SELECT count(*) FROM b);`
+
+// Backfill раскладывает по нормализованным таблицам заказы,
+// сохраненные без них, по backfillBatch заказов в транзакции.
+// Докуда дошел, помнит таблица normalize_backfill: прерванный
+// Backfill продолжает с места остановки, законченный ничего не делает,
+// пока ForgetBackfill не сбросит отметку. Возвращает число
+// разложенных заказов.
+func (s *PgStore) Backfill(ctx context.Context) (int64, error) {
+	var count int64
+	for {
+		n, done, err := s.backfillStep(ctx)
+		count += n
+		if err != nil || done {
+			return count, err
+		}
+	}
+}
+
+// backfillStep раскладывает одну порцию заказов. Строка
+// normalize_backfill заблокирована до конца транзакции,
+// так что два сервиса не раскладывают одно и то же.
+func (s *PgStore) backfillStep(ctx context.Context) (int64, bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		last string
+		done bool
+	)
+	const lockSQL = `SELECT last_pk, done FROM normalize_backfill FOR UPDATE;`
+	if err := tx.QueryRow(ctx, lockSQL).Scan(&last, &done); err != nil || done {
+		return 0, done, err
+	}
+
+	var (
+		next  *string
+		count int64
+	)
+	if err := tx.QueryRow(ctx, backfillSQL, last, backfillBatch).Scan(&next, &count); err != nil {
+		return 0, false, err
+	}
+	done = next == nil
+	if next != nil {
+		last = *next
+	}
+	const markSQL = `UPDATE normalize_backfill SET last_pk = $1, done = $2;`
+	if _, err := tx.Exec(ctx, markSQL, last, done); err != nil {
+		return 0, false, err
+	}
+	return count, done, tx.Commit(ctx)
+}
+
+// ForgetBackfill сбрасывает отметку Backfill: заказы, сохраненные
+// без config.Normalize, нужно будет разложить заново.
+func (s *PgStore) ForgetBackfill(ctx context.Context) error {
+	const sql = `UPDATE normalize_backfill SET last_pk = '', done = FALSE
+		WHERE done OR last_pk <> '';`
+	_, err := s.db.Exec(ctx, sql)
+	return err
+}
+
+// parseOrders разбирает заказы пакета для нормализованных таблиц.
+// Заказы, которые не разобрать, получают ErrMalformed и в пакет не идут.
+func parseOrders(batch []*inspector.OrderBox) ([]*inspector.OrderBox, []*Order) {
+	valid := batch[:0:0]
+	orders := make([]*Order, 0, len(batch))
+	for _, box := range batch {
+		o := &Order{}
+		if err := json.Unmarshal(box.Data, o); err != nil {
+			box.Err = fmt.Errorf("%w: %v", ErrMalformed, err)
+			continue
+		}
+		valid = append(valid, box)
+		orders = append(orders, o)
+	}
+	return valid, orders
+}
+
+// insertNormal пишет строки заказов, вставленных upsertSQL,
+// по запросу на строку. При ошибке возвращает индекс заказа,
+// чья строка упала, или -1, если ошибка относится ко всему пакету.
+func insertNormal(ctx context.Context, tx pgx.Tx, orders []*Order, status []int) (int, error) {
+	pgBatch := &pgx.Batch{}
+	var owner []int
+	for i, o := range orders {
+		if status[i] != upsertInserted {
+			continue
+		}
+		o.normalize(func(table string, values ...any) {
+			pgBatch.Queue(normalSQL[table], values...)
+			owner = append(owner, i)
+		})
+	}
+	if len(owner) == 0 {
+		return -1, nil
+	}
+
+	results := tx.SendBatch(ctx, pgBatch)
+	for _, i := range owner {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			return i, err
+		}
+	}
+	return -1, results.Close()
+}
+
+// copyNormal пишет строки заказов, вставленных copyUpsertSQL,
+// через COPY в каждую таблицу.
+func copyNormal(ctx context.Context, tx pgx.Tx, orders []*Order, status []int) error {
+	rows := make(map[string][][]any, len(normalTables))
+	for i, o := range orders {
+		if status[i] != upsertInserted {
+			continue
+		}
+		o.normalize(func(table string, values ...any) {
+			rows[table] = append(rows[table], values)
+		})
+	}
+	for _, t := range normalTables {
+		if len(rows[t]) == 0 {
+			continue
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{t}, normalColumns[t], pgx.CopyFromRows(rows[t])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
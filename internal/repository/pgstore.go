@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"0lvl/config"
+	"0lvl/internal/inspector"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// лимит каждого запроса при обходе заказов в Scan
+const selectLimit = 1024
+
+// PgStore — OrderStore в Postgres: trade, нормализованные таблицы
+// и rejected_order. Схему создают миграции, см. MigrateUp.
+type PgStore struct {
+	db  *pgxpool.Pool
+	log zerolog.Logger
+
+	// Размер пакета, с которого SaveOrderBatch идет через COPY.
+	copyThreshold int
+	// Писать ли нормализованные таблицы.
+	normalize bool
+}
+
+// NewPgStore создает пул подключений к cfg.PgString.
+func NewPgStore(ctx context.Context, cfg config.Config, log zerolog.Logger) (*PgStore, error) {
+	db, err := pgxpool.New(ctx, cfg.PgString)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PgStore{
+		db:            db,
+		log:           log,
+		copyThreshold: cfg.CopyThreshold,
+		normalize:     cfg.Normalize,
+	}, nil
+}
+
+// Close закрывает пул подключений.
+func (s *PgStore) Close() {
+	s.db.Close()
+}
+
+// Что стало с заказом в upsertSQL.
+const (
+	upsertInserted = iota
+	upsertDuplicate
+	upsertConflict
+	upsertUnseen
+)
+
+// upsertSQL вставляет заказ, если его uid еще нет,
+// иначе сравнивает хеш содержимого с сохраненным.
+// У заказов, сохраненных до появления hash, сравнивается само содержимое.
+// Подзапрос к trade видит таблицу до вставки из ins.
+// Если тот же uid вставила параллельная транзакция, ON CONFLICT ждет ее,
+// а подзапрос строку не видит: это upsertUnseen, заказ сохраняется заново.
+const upsertSQL = `WITH ins AS (
+		INSERT INTO trade (pk, rang, entity, hash) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (pk) DO NOTHING
+		RETURNING 1
+	)
+	SELECT CASE
+		WHEN EXISTS (SELECT FROM ins) THEN 0
+		WHEN NOT EXISTS (SELECT FROM trade WHERE pk = $1) THEN 3
+		WHEN (SELECT coalesce(hash = $4, entity = $3) FROM trade WHERE pk = $1) THEN 1
+		ELSE 2
+	END;`
+
+// SaveOrderBatch сохраняет пакет в trade, см. OrderStore.
+// Пакет сохраняется целиком или не сохраняется вовсе,
+// класс ошибки см. Classify.
+// Большие пакеты идут через COPY, см. saveCopy, остальные — saveBatch.
+//
+// Вместе с trade в той же транзакции вставленные заказы раскладываются
+// по нормализованным таблицам. Заказ, который в них не ложится,
+// получает ErrMalformed и в пакет не попадает.
+func (s *PgStore) SaveOrderBatch(ctx context.Context, batch []*inspector.OrderBox) {
+	valid, orders := batch, []*Order(nil)
+	if s.normalize {
+		valid, orders = parseOrders(batch)
+		if len(valid) == 0 {
+			return
+		}
+	}
+
+	if s.copyThreshold > 0 && len(valid) >= s.copyThreshold {
+		status, err := s.saveCopy(ctx, valid, orders)
+		// Постоянную ошибку COPY не привязать к заказу,
+		// виноватого найдет saveBatch.
+		if err == nil || Classify(err) != ErrorPermanent {
+			settle(valid, status, err)
+			return
+		}
+		s.log.Warn().Err(err).Int("count orders", len(valid)).Msg("copy error, fallback to batch insert")
+	}
+	s.saveBatch(ctx, valid, orders)
+}
+
+// saveBatch собирает INSERT на каждый заказ в пакет и отправляет в базу,
+// затем строки нормализованных таблиц для orders, если они есть.
+// Все идет одной транзакцией: если хоть один INSERT упал,
+// не сохранен ни один заказ. Остальные получают ErrBatchAborted.
+func (s *PgStore) saveBatch(ctx context.Context, batch []*inspector.OrderBox, orders []*Order) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		settle(batch, nil, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	pgBatch := &pgx.Batch{}
+	for _, box := range batch {
+		hash := sha256.Sum256(box.Data)
+		pgBatch.Queue(upsertSQL, box.Uid, box.Rang, box.Data, hash[:])
+	}
+
+	results := tx.SendBatch(ctx, pgBatch)
+	status, failed := scanUpserts(results, batch)
+
+	if err := results.Close(); err != nil && failed < 0 {
+		settle(batch, nil, err)
+		return
+	}
+
+	if failed < 0 && orders != nil {
+		i, err := insertNormal(ctx, tx, orders, status)
+		switch {
+		case i >= 0:
+			batch[i].Err = err
+			failed = i
+		case err != nil:
+			settle(batch, nil, err)
+			return
+		}
+	}
+
+	if failed >= 0 {
+		abort(batch, failed)
+		return
+	}
+
+	// Ошибка фиксации относится ко всему пакету.
+	if err := tx.Commit(ctx); err != nil {
+		settle(batch, nil, err)
+		return
+	}
+	settle(batch, status, nil)
+}
+
+// settle раздает заказам итог сохранения по status из upsertSQL,
+// err — ошибка всего пакета.
+func settle(batch []*inspector.OrderBox, status []int, err error) {
+	for i, box := range batch {
+		switch {
+		case err != nil:
+			box.Err = err
+		case status[i] == upsertDuplicate:
+			box.Err = ErrDuplicate
+		case status[i] == upsertConflict:
+			box.Err = ErrConflict
+		case status[i] == upsertUnseen:
+			box.Err = ErrUnseen
+		}
+	}
+}
+
+// scanUpserts читает итоги upsertSQL по заказам пакета.
+// Возвращает индекс первого упавшего заказа или -1.
+// После ошибки pgx возвращает ее же на все следующие запросы пакета,
+// так что ошибку получает только первый упавший заказ, см. abort.
+func scanUpserts(results pgx.BatchResults, batch []*inspector.OrderBox) ([]int, int) {
+	failed := -1
+	status := make([]int, len(batch))
+	for i, box := range batch {
+		err := results.QueryRow().Scan(&status[i])
+		if err != nil && failed < 0 {
+			box.Err = err
+			failed = i
+		}
+	}
+	return status, failed
+}
+
+// abort оставляет ошибку заказу failed, с которого откатился пакет,
+// остальные заказы получают ErrBatchAborted, что бы ни вернула база.
+func abort(batch []*inspector.OrderBox, failed int) {
+	for i, box := range batch {
+		if i != failed {
+			box.Err = ErrBatchAborted
+		}
+	}
+}
+
+func (s *PgStore) Order(ctx context.Context, uid string) ([]byte, error) {
+	const sql = `SELECT entity FROM trade WHERE pk = $1;`
+
+	var b []byte
+	err := s.db.QueryRow(ctx, sql, uid).Scan(&b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (s *PgStore) Recent(ctx context.Context, count int) ([]StoredOrder, error) {
+	const sql = `SELECT pk, rang FROM trade ORDER BY rang DESC LIMIT $1;`
+
+	rows, err := s.db.Query(ctx, sql, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]StoredOrder, 0, count)
+	for rows.Next() {
+		var o StoredOrder
+		if err := rows.Scan(&o.Uid, &o.Rang); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (s *PgStore) Count(ctx context.Context) (int, error) {
+	const sql = `SELECT count(pk) FROM trade;`
+
+	var count int
+	err := s.db.QueryRow(ctx, sql).Scan(&count)
+	return count, err
+}
+
+// Scan читает trade порциями по selectLimit от больших rang к меньшим.
+func (s *PgStore) Scan(ctx context.Context, fn func(o StoredOrder) bool) error {
+	const (
+		first = `SELECT pk, rang, entity FROM trade ORDER BY rang DESC LIMIT $1;`
+		next  = `SELECT pk, rang, entity FROM trade WHERE rang < $2 ORDER BY rang DESC LIMIT $1;`
+	)
+
+	var cursor int64
+	for {
+		var rows pgx.Rows
+		var err error
+		if cursor == 0 {
+			rows, err = s.db.Query(ctx, first, selectLimit)
+		} else {
+			rows, err = s.db.Query(ctx, next, selectLimit, cursor)
+		}
+		if err != nil {
+			return err
+		}
+
+		processed := 0
+		for rows.Next() {
+			// RawValues действительны до следующей строки,
+			// fn не должна их сохранять.
+			v := rows.RawValues()
+			o := StoredOrder{Uid: string(v[0]), Rang: int64(binary.BigEndian.Uint64(v[1])), Data: v[2]}
+			if !fn(o) {
+				rows.Close()
+				return nil
+			}
+			cursor = o.Rang
+			processed++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if processed == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"0lvl/internal/inspector"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pipelineResults повторяет pgx v5 pipelineBatchResults:
+// после первой ошибки каждый следующий QueryRow возвращает ее же.
+type pipelineResults struct {
+	// Ошибка запроса с этим номером, остальные вставляют заказ.
+	failAt int
+	fail   error
+
+	n   int
+	err error
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int) = upsertInserted
+	return nil
+}
+
+func (r *pipelineResults) QueryRow() pgx.Row {
+	if r.err == nil && r.n == r.failAt {
+		r.err = r.fail
+	}
+	r.n++
+	return errRow{r.err}
+}
+
+func (r *pipelineResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, r.err }
+func (r *pipelineResults) Query() (pgx.Rows, error)         { return nil, r.err }
+func (r *pipelineResults) Close() error                     { return r.err }
+
+func TestScanUpserts_PipelineError(t *testing.T) {
+	tooLong := &pgconn.PgError{Code: "22001"}
+	batch := make([]*inspector.OrderBox, 4)
+	for i := range batch {
+		batch[i] = &inspector.OrderBox{}
+	}
+
+	status, failed := scanUpserts(&pipelineResults{failAt: 1, fail: tooLong}, batch)
+	if failed != 1 || len(status) != len(batch) {
+		t.Fatalf("got failed %d, want 1", failed)
+	}
+	abort(batch, failed)
+
+	for i, box := range batch {
+		want := ErrorTransient
+		if i == 1 {
+			want = ErrorPermanent
+		}
+		if got := Classify(box.Err); got != want {
+			t.Errorf("order %d: got %s (%v), want %s", i, got, box.Err, want)
+		}
+	}
+	if !errors.Is(batch[1].Err, tooLong) {
+		t.Errorf("failed order lost its error: %v", batch[1].Err)
+	}
+}
@@ -1,20 +1,18 @@
 package repository
 
 import (
+	"bufio"
 	"context"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
-	"strings"
+	"io"
+	"os"
+	"sync/atomic"
 	"time"
 
-	"0lvl/config"
 	"0lvl/internal/inspector"
 	"0lvl/pkg/cache"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
 )
 
@@ -22,34 +20,36 @@ const (
 	// maxCacheBytes - максимальный размер кеша (FIFO).
 	maxCacheBytes = 1024 * 1024 * 32
 
-	// лимит каждого запроса при заполнении кеша при старте
-	selectLimit = 1024
-
 	urlOrder = "http://localhost:8000/order/"
+
+	// snapshotHeader открывает файл снимка кеша,
+	// за ним отпечаток и перевод строки.
+	snapshotHeader = "orders cache snapshot "
 )
 
+// ErrStaleSnapshot — снимок кеша снят с другим отпечатком:
+// заказы в нем могут выглядеть не так, как сохраняет текущий сервис.
+var ErrStaleSnapshot = errors.New("cache snapshot fingerprint mismatch")
+
+// Repo — заказы в хранилище OrderStore с кешем перед ним.
 type Repo struct {
-	db    *pgxpool.Pool
+	store OrderStore
 	cache *cache.Cache
 	log   zerolog.Logger
-}
 
-// Инициализирует репозиторий.
-// 1) Пул подключений к базе данных
-// 2) Кеш
-func New(ctx context.Context, cfg config.Config, log zerolog.Logger) (*Repo, error) {
-	db, err := pgxpool.New(ctx, cfg.PgString)
-	if err != nil {
-		return nil, err
-	}
+	duplicates atomic.Uint64
+	conflicts  atomic.Uint64
+}
 
+// Инициализирует репозиторий над store, кеш пустой.
+func New(store OrderStore, log zerolog.Logger) (*Repo, error) {
 	cache, err := cache.New(maxCacheBytes)
 	if err != nil {
 		return nil, err
 	}
 
 	repo := &Repo{
-		db:    db,
+		store: store,
 		cache: cache,
 		log:   log,
 	}
@@ -57,7 +57,59 @@ func New(ctx context.Context, cfg config.Config, log zerolog.Logger) (*Repo, err
 	return repo, nil
 }
 
-// Возвращает заказ из кеша, если в кеше нет то из базы данных
+// Close закрывает хранилище.
+func (r *Repo) Close() {
+	r.store.Close()
+}
+
+// SaveCacheSnapshot сохраняет кеш в файл,
+// чтобы при следующем старте не прогревать его из базы.
+// fingerprint — отпечаток схем и полей, см. inspector.Transformer.Fingerprint.
+func (r *Repo) SaveCacheSnapshot(path, fingerprint string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, snapshotHeader+fingerprint+"\n")
+	if err == nil {
+		err = r.cache.SaveTo(f)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCacheSnapshot заполняет кеш из файла SaveCacheSnapshot.
+// Заказы, сохраненные после снимка, будут читаться из базы.
+// Снимок с другим отпечатком не загружается: ErrStaleSnapshot.
+func (r *Repo) LoadCacheSnapshot(path, fingerprint string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, err := br.ReadString('\n')
+	if err != nil || header != snapshotHeader+fingerprint+"\n" {
+		return ErrStaleSnapshot
+	}
+	if err := r.cache.LoadFrom(br); err != nil {
+		r.cache.Reset()
+		return err
+	}
+	return nil
+}
+
+// Возвращает заказ из кеша, если в кеше нет то из хранилища.
 func (r *Repo) Order(uid string) ([]byte, error) {
 	var b []byte
 
@@ -66,149 +118,81 @@ func (r *Repo) Order(uid string) ([]byte, error) {
 		return b, nil
 	}
 
-	const sql = `SELECT entity FROM trade WHERE pk = $1;`
-	err := r.db.QueryRow(context.Background(), sql, uid).Scan(&b)
-	if err != nil {
-		return nil, err
-	}
-	return b, nil
+	return r.store.Order(context.Background(), uid)
 }
 
-// Собирает sql в пакет и отправляет в базу
-// успешно сохраненные сохраняет в кеш по одному
-// при ошибке INSERT в кеш непоподает, а в box добавляется ошибка pg.
+// Сохраняет пакет заказов, успешно сохраненные кладет в кеш,
+// остальные получают ошибку в box.Err, см. OrderStore.SaveOrderBatch.
 func (r *Repo) SaveOrderBatch(batch []*inspector.OrderBox) []*inspector.OrderBox {
 	defer timer(r.log)(len(batch))
 
-	pgBatch := &pgx.Batch{}
-	const sql = `INSERT INTO trade (pk, rang, entity) VALUES ($1, $2, $3);`
-
-	for _, box := range batch {
-		pgBatch.Queue(sql, box.Uid, box.Rang, box.Data)
-	}
-
-	results := r.db.SendBatch(context.Background(), pgBatch)
-	defer results.Close()
-
+	r.store.SaveOrderBatch(context.Background(), batch)
 	for _, box := range batch {
-		_, err := results.Exec()
-
-		if err != nil {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				box.Err = pgErr
-			}
-			continue
+		switch {
+		case errors.Is(box.Err, ErrDuplicate):
+			r.duplicates.Add(1)
+		case errors.Is(box.Err, ErrConflict):
+			r.conflicts.Add(1)
+		case box.Err == nil:
+			r.cache.Set([]byte(box.Uid), box.Data)
 		}
-		r.cache.Set([]byte(box.Uid), box.Data)
 	}
-
 	return batch
 }
 
 // Возвращает список ссылок заказов на детальный просмотр.
 func (r *Repo) OrdersLink(count int) []byte {
-	const sql = `SELECT pk, rang FROM trade ORDER BY rang DESC LIMIT $1;`
-
-	rows, err := r.db.Query(context.Background(), sql, count)
+	orders, err := r.store.Recent(context.Background(), count)
 	if err != nil {
-		r.log.Err(err).Msg("")
-	}
-	defer rows.Close()
-
-	entities := make([]OrderLink, 0, count)
-
-	for rows.Next() {
-		rowValues := rows.RawValues()
-		pk := string(rowValues[0])
-
-		var sb strings.Builder
-		sb.WriteString(urlOrder)
-		sb.WriteString(pk)
-
-		entity := OrderLink{
-			Uid:  pk,
-			Link: sb.String(),
-		}
-		entities = append(entities, entity)
+		r.log.Err(err).Msg("db error")
 	}
 
-	if err := rows.Err(); err != nil {
-		r.log.Err(err).Msg("db error")
+	entities := make([]OrderLink, 0, len(orders))
+	for _, o := range orders {
+		entities = append(entities, OrderLink{
+			Uid:  o.Uid,
+			Link: urlOrder + o.Uid,
+		})
 	}
 
 	b, _ := json.Marshal(entities)
 	return b
 }
 
+// Search ищет заказы мимо кеша, см. OrderQuery.
+func (r *Repo) Search(q OrderQuery) (OrderPage, error) {
+	return r.store.Search(context.Background(), q)
+}
+
 // Возвращает информацию по кешу и базе данных.
 func (r *Repo) Metrica() []byte {
 	var m Monitor
 	r.cache.UpdateStats(&m.Cache)
+	m.DuplicateOrders = r.duplicates.Load()
+	m.ConflictOrders = r.conflicts.Load()
 
-	const sql = `SELECT count(pk) FROM trade;`
-	err := r.db.QueryRow(context.Background(), sql).Scan(&m.DatabaseOrderCount)
+	count, err := r.store.Count(context.Background())
 	if err != nil {
 		r.log.Err(err).Msg("db error")
 	}
+	m.DatabaseOrderCount = count
 
 	mb, _ := json.Marshal(m)
 	return mb
 }
 
-// Рекурсивно заполняет кеш заказами из базы данных.
-// Пока в одном из баскетов кеша не потребуется удалять записи
+// Заполняет кеш заказами из хранилища, от новых к старым,
+// пока в одном из баскетов кеша не потребуется удалять записи.
 // Это заполняет кеш на 50%, хз как его заполнить чтобы более
 // старые записи не затерли свежие.
 // В данной реализации кеша с баскетами
 func (r *Repo) СacheWarmUp() {
-	r.cacheWarmUpChank(selectLimit, 0)
-}
-
-func (r *Repo) cacheWarmUpChank(limit int, cursor uint64) {
-	var sql strings.Builder
-	namedArgs := make(map[string]interface{})
-	namedArgs["limit"] = limit
-
-	sql.WriteString("SELECT pk, rang, entity FROM trade")
-
-	if cursor != 0 {
-		sql.WriteString(" WHERE rang < @cursor")
-		namedArgs["cursor"] = cursor
-	}
-
-	sql.WriteString(" ORDER BY rang DESC LIMIT @limit;")
-
-	rows, err := r.db.Query(context.Background(), sql.String(), pgx.NamedArgs(namedArgs))
+	err := r.store.Scan(context.Background(), func(o StoredOrder) bool {
+		return !r.cache.StopSet([]byte(o.Uid), o.Data)
+	})
 	if err != nil {
 		r.log.Err(err).Msg("db error")
 	}
-
-	rowsProcessed := 0
-	for rows.Next() {
-		rowValues := rows.RawValues()
-		hasNeedClean := r.cache.StopSet(rowValues[0], rowValues[2])
-
-		if hasNeedClean {
-			rows.Close()
-			return
-		}
-
-		cursor = binary.BigEndian.Uint64(rowValues[1])
-		rowsProcessed++
-	}
-
-	if err := rows.Err(); err != nil {
-		r.log.Err(err).Msg("db error")
-	}
-	
-	if rowsProcessed == 0 {
-		rows.Close()
-		return
-	}
-
-	rows.Close()
-	r.cacheWarmUpChank(selectLimit, cursor)
 }
 
 func timer(logger zerolog.Logger) func(c int) {
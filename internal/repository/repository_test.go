@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"0lvl/internal/inspector"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRepo_CacheSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	repo, err := New(NewMemStore(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SaveOrderBatch([]*inspector.OrderBox{{Uid: "snapshot", Data: []byte(`{"order_uid":"snapshot"}`)}})
+	if err := repo.SaveCacheSnapshot(path, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Хранилище пустое, заказ может прийти только из снимка.
+	load := func(fingerprint string) (*Repo, error) {
+		t.Helper()
+		repo, err := New(NewMemStore(), zerolog.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo, repo.LoadCacheSnapshot(path, fingerprint)
+	}
+
+	fresh, err := load("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fresh.Order("snapshot"); err != nil || string(b) != `{"order_uid":"snapshot"}` {
+		t.Errorf("order from snapshot: %s %v", b, err)
+	}
+
+	stale, err := load("b")
+	if !errors.Is(err, ErrStaleSnapshot) {
+		t.Fatalf("got %v, want ErrStaleSnapshot", err)
+	}
+	if _, err := stale.Order("snapshot"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("stale snapshot is loaded: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrBadCursor — курсор OrderQuery.After не выдавался Search.
+	ErrBadCursor = errors.New("bad cursor")
+	// ErrSearchDisabled — PgStore ищет по нормализованным таблицам,
+	// а они не пишутся без config.Normalize.
+	ErrSearchDisabled = errors.New("search requires normalized tables, set NORMALIZE=true")
+)
+
+// OrderQuery — условия поиска заказов, пустые не учитываются.
+// Заказы идут от новых к старым по date_created.
+type OrderQuery struct {
+	CustomerId  string
+	TrackNumber string
+	// Телефон получателя, delivery.phone.
+	Phone string
+	// Хоть один товар с таким chrt_id, 0 — не учитывается.
+	ChrtId int64
+	// date_created в [From, To).
+	From, To time.Time
+	Limit    int
+	// After — курсор OrderPage.Next предыдущей страницы.
+	After string
+}
+
+// OrderPage — страница поиска. Next пустой на последней странице.
+type OrderPage struct {
+	Orders []StoredOrder
+	Next   string
+}
+
+// cursor — последний заказ страницы.
+type cursor struct {
+	date time.Time
+	uid  string
+}
+
+func (c cursor) String() string {
+	s := strconv.FormatInt(c.date.UnixNano(), 10) + "." + c.uid
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func parseCursor(s string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrBadCursor
+	}
+	ns, uid, ok := strings.Cut(string(b), ".")
+	n, err := strconv.ParseInt(ns, 10, 64)
+	if !ok || err != nil || uid == "" {
+		return cursor{}, ErrBadCursor
+	}
+	return cursor{date: time.Unix(0, n).UTC(), uid: uid}, nil
+}
+
+// before — заказ идет после курсора в порядке поиска.
+func (c cursor) before(date time.Time, uid string) bool {
+	if !date.Equal(c.date) {
+		return date.Before(c.date)
+	}
+	return uid < c.uid
+}
+
+// Search ищет заказы в нормализованных таблицах,
+// без config.Normalize они не пишутся и поиск возвращает ErrSearchDisabled:
+// пустой результат выглядел бы как «ничего не нашлось».
+func (s *PgStore) Search(ctx context.Context, q OrderQuery) (OrderPage, error) {
+	if !s.normalize {
+		return OrderPage{}, ErrSearchDisabled
+	}
+	args := pgx.NamedArgs{"limit": q.Limit + 1}
+	var where []string
+	cond := func(sql, name string, v any) {
+		where = append(where, sql)
+		args[name] = v
+	}
+
+	if q.CustomerId != "" {
+		cond("o.customer_id = @customer_id", "customer_id", q.CustomerId)
+	}
+	if q.TrackNumber != "" {
+		cond("o.track_number = @track_number", "track_number", q.TrackNumber)
+	}
+	if q.Phone != "" {
+		cond("EXISTS (SELECT FROM delivery d WHERE d.order_uid = o.order_uid AND d.phone = @phone)", "phone", q.Phone)
+	}
+	if q.ChrtId != 0 {
+		cond("EXISTS (SELECT FROM item i WHERE i.order_uid = o.order_uid AND i.chrt_id = @chrt_id)", "chrt_id", q.ChrtId)
+	}
+	if !q.From.IsZero() {
+		cond("o.date_created >= @from", "from", q.From)
+	}
+	if !q.To.IsZero() {
+		cond("o.date_created < @to", "to", q.To)
+	}
+	if q.After != "" {
+		c, err := parseCursor(q.After)
+		if err != nil {
+			return OrderPage{}, err
+		}
+		cond("(o.date_created, o.order_uid) < (@after_date, @after_uid)", "after_date", c.date)
+		args["after_uid"] = c.uid
+	}
+
+	var sql strings.Builder
+	sql.WriteString(`SELECT o.order_uid, o.date_created, t.rang, t.entity FROM "order" o JOIN trade t ON t.pk = o.order_uid`)
+	if len(where) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(where, " AND "))
+	}
+	sql.WriteString(" ORDER BY o.date_created DESC, o.order_uid DESC LIMIT @limit;")
+
+	rows, err := s.db.Query(ctx, sql.String(), args)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	defer rows.Close()
+
+	var page OrderPage
+	var last cursor
+	for rows.Next() {
+		var o StoredOrder
+		var date time.Time
+		if err := rows.Scan(&o.Uid, &date, &o.Rang, &o.Data); err != nil {
+			return OrderPage{}, err
+		}
+		if len(page.Orders) == q.Limit {
+			page.Next = last.String()
+			break
+		}
+		page.Orders = append(page.Orders, o)
+		last = cursor{date: date, uid: o.Uid}
+	}
+	return page, rows.Err()
+}
+
+// Search разбирает каждый заказ, как PgStore нормализованные таблицы.
+func (s *MemStore) Search(ctx context.Context, q OrderQuery) (OrderPage, error) {
+	var after *cursor
+	if q.After != "" {
+		c, err := parseCursor(q.After)
+		if err != nil {
+			return OrderPage{}, err
+		}
+		after = &c
+	}
+
+	type found struct {
+		StoredOrder
+		date time.Time
+	}
+	var all []found
+	s.mu.RLock()
+	for _, o := range s.orders {
+		var order Order
+		if err := json.Unmarshal(o.Data, &order); err != nil {
+			continue
+		}
+		if !q.match(&order) || after != nil && !after.before(order.DateCreated, o.Uid) {
+			continue
+		}
+		all = append(all, found{o, order.DateCreated})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return cursor{date: all[i].date, uid: all[i].Uid}.before(all[j].date, all[j].Uid)
+	})
+
+	var page OrderPage
+	for i, o := range all {
+		if i == q.Limit {
+			last := all[i-1]
+			page.Next = cursor{date: last.date, uid: last.Uid}.String()
+			break
+		}
+		page.Orders = append(page.Orders, o.StoredOrder)
+	}
+	return page, nil
+}
+
+func (q OrderQuery) match(o *Order) bool {
+	switch {
+	case q.CustomerId != "" && o.CustomerId != q.CustomerId,
+		q.TrackNumber != "" && o.TrackNumber != q.TrackNumber,
+		q.Phone != "" && o.Delivery.Phone != q.Phone,
+		!q.From.IsZero() && o.DateCreated.Before(q.From),
+		!q.To.IsZero() && !o.DateCreated.Before(q.To):
+		return false
+	}
+	if q.ChrtId == 0 {
+		return true
+	}
+	for _, it := range o.Items {
+		if int64(it.ChrtId) == q.ChrtId {
+			return true
+		}
+	}
+	return false
+}
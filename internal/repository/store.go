@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"0lvl/internal/inspector"
+)
+
+// Хранилища для config.Store.
+const (
+	StorePostgres = "postgres"
+	StoreMemory   = "memory"
+)
+
+// ErrNotFound — заказа или отвергнутого заказа с таким ключом нет.
+var ErrNotFound = errors.New("not found")
+
+// StoredOrder — сохраненный заказ. Rang — порядок сохранения,
+// у свежих больше.
+type StoredOrder struct {
+	Uid  string
+	Rang int64
+	Data []byte
+}
+
+// OrderStore — хранилище под Repo.
+// PgStore работает с Postgres, MemStore держит все в памяти
+// для тестов и локальной разработки.
+type OrderStore interface {
+	// SaveOrderBatch сохраняет пакет целиком или не сохраняет вовсе,
+	// итог каждого заказа в box.Err: nil — сохранен,
+	// ErrDuplicate — точно такой же уже есть,
+	// ErrConflict — под тем же uid другое содержимое, сохраненный не меняется,
+	// иначе ошибка хранилища, см. Classify.
+	SaveOrderBatch(ctx context.Context, batch []*inspector.OrderBox)
+	// Order возвращает заказ или ErrNotFound.
+	Order(ctx context.Context, uid string) ([]byte, error)
+	// Recent возвращает count самых свежих заказов без Data.
+	Recent(ctx context.Context, count int) ([]StoredOrder, error)
+	Count(ctx context.Context) (int, error)
+	// Scan обходит заказы от свежих к старым, пока fn возвращает true.
+	// Data действительна только внутри fn.
+	Scan(ctx context.Context, fn func(o StoredOrder) bool) error
+	// Search ищет заказы по q, курсор с чужой страницы — ErrBadCursor.
+	Search(ctx context.Context, q OrderQuery) (OrderPage, error)
+
+	SaveRejected(ctx context.Context, rec RejectedOrder) error
+	// RejectedOrders возвращает отвергнутые заказы без payload
+	// по убыванию id, before — id, с которого продолжить, 0 — с самого нового.
+	RejectedOrders(ctx context.Context, limit int, before int64) ([]RejectedOrder, error)
+	// RejectedOrder возвращает отвергнутый заказ с payload или ErrNotFound.
+	RejectedOrder(ctx context.Context, id int64) (RejectedOrder, error)
+	MarkResubmitted(ctx context.Context, id int64) error
+
+	Close()
+}
@@ -0,0 +1,489 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+const header = "// Code generated by schemagen from internal/schema/order.json. DO NOT EDIT.\n\n"
+
+// GoTypes генерирует структуры заказа для пакета repository.
+func GoTypes(def *Definition) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("package repository\n\n")
+	if def.uses(func(f Field) bool { return f.Format == FormatDateTime }) {
+		b.WriteString("import \"time\"\n\n")
+	}
+
+	for _, t := range def.Types {
+		fmt.Fprintf(&b, "type %s struct {\n", t.Name)
+		for _, f := range t.Fields {
+			typ := f.Type
+			if f.Format == FormatDateTime {
+				typ = "time.Time"
+			}
+			fmt.Fprintf(&b, "%s %s `json:%q`\n", f.Name, typ, f.Key)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	tables, err := def.tables()
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString("// normalTables — нормализованные таблицы в порядке вставки,\n")
+	b.WriteString("// normalColumns — их колонки в порядке значений normalize.\n")
+	b.WriteString("var normalTables = []string{")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "%q, ", t.name)
+	}
+	b.WriteString("}\n\nvar normalColumns = map[string][]string{\n")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "%q: {", t.name)
+		for _, c := range t.columns() {
+			fmt.Fprintf(&b, "%q, ", c)
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}\n\n")
+
+	recv := strings.ToLower(def.Root[:1])
+	pk, _ := def.field(def.Root, def.PrimaryKey)
+	fmt.Fprintf(&b, "// normalize раскладывает заказ на строки таблиц normalTables.\n")
+	fmt.Fprintf(&b, "func (%s *%s) normalize(row func(table string, values ...any)) {\n", recv, def.Root)
+	for _, t := range tables {
+		switch {
+		case t.key == "":
+			fmt.Fprintf(&b, "row(%q", t.name)
+			writeValues(&b, recv, t.fields)
+		case t.array:
+			fmt.Fprintf(&b, "for i := range %s.%s {\n", recv, t.via.Name)
+			fmt.Fprintf(&b, "row(%q, %s.%s, i", t.name, recv, pk.Name)
+			writeValues(&b, fmt.Sprintf("%s.%s[i]", recv, t.via.Name), t.fields)
+			b.WriteString("}\n")
+		default:
+			fmt.Fprintf(&b, "row(%q, %s.%s", t.name, recv, pk.Name)
+			writeValues(&b, recv+"."+t.via.Name, t.fields)
+		}
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
+
+func writeValues(b *bytes.Buffer, prefix string, fields []Field) {
+	for _, f := range fields {
+		fmt.Fprintf(b, ", %s.%s", prefix, f.Name)
+	}
+	b.WriteString(")\n")
+}
+
+// InspectorScheme генерирует createScheme для пакета inspector.
+func InspectorScheme(def *Definition) ([]byte, error) {
+	root := def.index[def.Root]
+
+	var objKeys, itemKeys int
+	for _, f := range root.Fields {
+		if f.Scalar() {
+			continue
+		}
+		name, array := f.Elem()
+		if array {
+			itemKeys += len(def.index[name].Fields)
+		} else {
+			objKeys += len(def.index[name].Fields)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("package inspector\n\n")
+	b.WriteString("import \"github.com/romshark/jscan/v2\"\n\n")
+	b.WriteString("// Keys — ключей в корне заказа, ObjKeys — во вложенных объектах,\n")
+	b.WriteString("// ItemKeys — в одном товаре.\n")
+	fmt.Fprintf(&b, "const (\nKeys = %d\nObjKeys = %d\nItemKeys = %d\n)\n\n", len(root.Fields), objKeys, itemKeys)
+
+	b.WriteString("func createScheme() *node {\n")
+	if def.uses(func(f Field) bool { return f.Type == TypeString }) {
+		b.WriteString("str := jscan.ValueTypeString\n")
+	}
+	if def.uses(func(f Field) bool { return f.Type == TypeInt }) {
+		b.WriteString("num := jscan.ValueTypeNumber\n")
+	}
+
+	order, err := def.dependencies()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		fmt.Fprintf(&b, "\n%s := ", varName(name))
+		writeObject(&b, def.index[name])
+	}
+	b.WriteString("\nreturn ")
+	writeObject(&b, root)
+	b.WriteString("}\n")
+
+	return format.Source(b.Bytes())
+}
+
+func writeObject(b *bytes.Buffer, t *Type) {
+	b.WriteString("object(\n")
+	for _, f := range t.Fields {
+		if f.Comment != "" {
+			fmt.Fprintf(b, "// %s\n", f.Comment)
+		}
+		fmt.Fprintf(b, "field{%q, %d, ", f.Key, f.Number)
+		name, array := f.Elem()
+		switch {
+		case f.Scalar() && f.Format != "":
+			fmt.Fprintf(b, "formatted(%s, %s)", scalarVar(f.Type), formatConst(f.Format))
+		case f.Scalar():
+			fmt.Fprintf(b, "scalar(%s)", scalarVar(f.Type))
+		case array:
+			fmt.Fprintf(b, "array(%s, %d)", varName(name), f.MinItems)
+		default:
+			b.WriteString(varName(name))
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString(")\n")
+}
+
+func scalarVar(typ string) string {
+	if typ == TypeString {
+		return "str"
+	}
+	return "num"
+}
+
+func formatConst(format string) string {
+	if format == FormatDateTime {
+		return "FormatDateTime"
+	}
+	return "FormatUnixTime"
+}
+
+func varName(typ string) string {
+	return strings.ToLower(typ[:1]) + typ[1:]
+}
+
+func (def *Definition) uses(pred func(Field) bool) bool {
+	for _, t := range def.Types {
+		for _, f := range t.Fields {
+			if pred(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dependencies возвращает вложенные типы так,
+// чтобы каждый шел после тех, на которые ссылается.
+func (def *Definition) dependencies() ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(def.Types))
+	var order []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("schema: type %s references itself", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, f := range def.index[name].Fields {
+			if f.Scalar() {
+				continue
+			}
+			elem, _ := f.Elem()
+			if err := visit(elem); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		if name != def.Root {
+			order = append(order, name)
+		}
+		return nil
+	}
+
+	if err := visit(def.Root); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// table — нормализованная таблица: корень или вложенный тип,
+// на который корень ссылается полем via по ключу key.
+type table struct {
+	name   string
+	key    string
+	via    Field
+	array  bool
+	fields []Field
+}
+
+// columns — колонки таблицы: у вложенных впереди ключ корня,
+// у массивов за ним idx — место элемента в массиве.
+func (t table) columns() []string {
+	var cols []string
+	if t.key != "" {
+		cols = append(cols, t.key)
+	}
+	if t.array {
+		cols = append(cols, "idx")
+	}
+	for _, f := range t.fields {
+		cols = append(cols, f.Key)
+	}
+	return cols
+}
+
+// tables раскладывает описание по таблицам: корень и по таблице
+// на каждое его вложенное поле. Вложенность глубже одного уровня
+// и один тип в двух полях не поддерживаются.
+func (def *Definition) tables() ([]table, error) {
+	root := table{name: snakeName(def.Root)}
+	var nested []table
+	seen := map[string]bool{}
+	for _, f := range def.index[def.Root].Fields {
+		if f.Scalar() {
+			root.fields = append(root.fields, f)
+			continue
+		}
+		name, array := f.Elem()
+		if seen[name] {
+			return nil, fmt.Errorf("schema: type %s is used by two fields", name)
+		}
+		seen[name] = true
+		t := table{name: snakeName(name), key: def.PrimaryKey, via: f, array: array}
+		for _, nf := range def.index[name].Fields {
+			if !nf.Scalar() {
+				return nil, fmt.Errorf("schema: %s.%s: nested objects deeper than one level", name, nf.Key)
+			}
+			t.fields = append(t.fields, nf)
+		}
+		nested = append(nested, t)
+	}
+	return append([]table{root}, nested...), nil
+}
+
+func snakeName(typ string) string {
+	var b strings.Builder
+	for i, r := range typ {
+		if 'A' <= r && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// SQLTables генерирует DDL нормализованных таблиц.
+// Корень ссылается на trade, где хранится заказ целиком,
+// вложенные таблицы — на корень.
+func SQLTables(def *Definition) ([]byte, error) {
+	tables, err := def.tables()
+	if err != nil {
+		return nil, err
+	}
+	pk, _ := def.field(def.Root, def.PrimaryKey)
+	root := tables[0].name
+
+	var b bytes.Buffer
+	b.WriteString(strings.Replace(header, "//", "--", 1))
+	for _, t := range tables {
+		fmt.Fprintf(&b, "CREATE TABLE %q (\n", t.name)
+		var lines []string
+		switch {
+		case t.key == "":
+			lines = append(lines, fmt.Sprintf("%s TEXT PRIMARY KEY REFERENCES trade (pk) ON DELETE CASCADE", pk.Key))
+		case t.array:
+			lines = append(lines,
+				fmt.Sprintf("%s TEXT NOT NULL REFERENCES %q ON DELETE CASCADE", t.key, root),
+				"idx INTEGER NOT NULL")
+		default:
+			lines = append(lines, fmt.Sprintf("%s TEXT PRIMARY KEY REFERENCES %q ON DELETE CASCADE", t.key, root))
+		}
+		for _, f := range t.fields {
+			if f.Key == pk.Key && t.key == "" {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s %s NOT NULL", f.Key, sqlType(f)))
+		}
+		if t.array {
+			lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s, idx)", t.key))
+		}
+		b.WriteString("    " + strings.Join(lines, ",\n    ") + "\n);\n\n")
+	}
+	for _, t := range tables {
+		for _, f := range t.fields {
+			if f.Index {
+				fmt.Fprintf(&b, "CREATE INDEX %s_%s_idx ON %q (%s);\n", t.name, f.Key, t.name, f.Key)
+			}
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// sqlType: unix-time остается числом, как в заказе.
+func sqlType(f Field) string {
+	switch {
+	case f.Format == FormatDateTime:
+		return "TIMESTAMPTZ"
+	case f.Type == TypeInt:
+		return "BIGINT"
+	}
+	return "TEXT"
+}
+
+type jsonSchema struct {
+	Schema               string      `json:"$schema,omitempty"`
+	Title                string      `json:"title,omitempty"`
+	Definitions          properties  `json:"definitions,omitempty"`
+	Ref                  string      `json:"$ref,omitempty"`
+	Type                 string      `json:"type,omitempty"`
+	Format               string      `json:"format,omitempty"`
+	AdditionalProperties *bool       `json:"additionalProperties,omitempty"`
+	Required             []string    `json:"required,omitempty"`
+	Properties           properties  `json:"properties,omitempty"`
+	MinItems             int         `json:"minItems,omitempty"`
+	Items                *jsonSchema `json:"items,omitempty"`
+}
+
+type property struct {
+	name   string
+	schema *jsonSchema
+}
+
+// properties сохраняет порядок ключей как в описании.
+type properties []property
+
+func (p properties) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(prop.name)
+		b.Write(key)
+		b.WriteByte(':')
+		val, err := json.Marshal(prop.schema)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// JSONSchema генерирует документ JSON Schema draft-04.
+// Числа описаны как integer: инспектор пропускает только целые в пределах int64.
+func JSONSchema(def *Definition) ([]byte, error) {
+	order, err := def.dependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := def.jsonObject(def.index[def.Root])
+	doc.Schema = "http://json-schema.org/draft-04/schema#"
+	doc.Title = def.Root
+	for _, name := range order {
+		doc.Definitions = append(doc.Definitions, property{varName(name), def.jsonObject(def.index[name])})
+	}
+
+	b, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (def *Definition) jsonObject(t *Type) *jsonSchema {
+	closed := false
+	s := &jsonSchema{
+		Type:                 "object",
+		AdditionalProperties: &closed,
+	}
+	for _, f := range t.Fields {
+		s.Required = append(s.Required, f.Key)
+		s.Properties = append(s.Properties, property{f.Key, jsonField(f)})
+	}
+	return s
+}
+
+func jsonField(f Field) *jsonSchema {
+	switch f.Type {
+	case TypeString:
+		s := &jsonSchema{Type: "string"}
+		if f.Format == FormatDateTime {
+			s.Format = f.Format
+		}
+		return s
+	case TypeInt:
+		return &jsonSchema{Type: "integer"}
+	}
+
+	name, array := f.Elem()
+	ref := &jsonSchema{Ref: "#/definitions/" + varName(name)}
+	if !array {
+		return ref
+	}
+	return &jsonSchema{Type: "array", MinItems: f.MinItems, Items: ref}
+}
+
+// ProtoFile генерирует order.proto для паблишеров Protobuf.
+// Инспектор разбирает сообщения по тем же номерам полей.
+func ProtoFile(def *Definition) ([]byte, error) {
+	order, err := def.dependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("syntax = \"proto3\";\n\npackage orders;\n")
+	for _, name := range append([]string{def.Root}, order...) {
+		fmt.Fprintf(&b, "\nmessage %s {\n", name)
+		for _, f := range def.index[name].Fields {
+			if f.Comment != "" {
+				fmt.Fprintf(&b, "  // %s\n", f.Comment)
+			}
+			fmt.Fprintf(&b, "  %s %s = %d;\n", protoType(f), f.Key, f.Number)
+		}
+		if name == def.Root {
+			b.WriteString("  // Версия схемы, пусто — 1.\n")
+			fmt.Fprintf(&b, "  string schema_version = %d;\n", VersionNumber)
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes(), nil
+}
+
+func protoType(f Field) string {
+	switch f.Type {
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int64"
+	}
+	name, array := f.Elem()
+	if array {
+		return "repeated " + name
+	}
+	return name
+}
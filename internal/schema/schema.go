@@ -0,0 +1,215 @@
+// Package schema — единое описание заказа.
+// Из order.json генерируются типы repository.Order,
+// схема инспектора, документ JSON Schema и order.proto для паблишеров
+// и order.sql — нормализованные таблицы. order.sql в базу попадает
+// только миграцией из internal/repository/migrations:
+// изменили таблицы — добавьте миграцию.
+package schema
+
+//go:generate go run ../../cmd/schemagen
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Типы полей, кроме них поле может ссылаться на объект: Item или []Item.
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+)
+
+// Форматы совпадают с inspector.FormatDateTime и inspector.FormatUnixTime.
+const (
+	FormatDateTime = "date-time"
+	FormatUnixTime = "unix-time"
+)
+
+// Номера полей protobuf. VersionNumber занят schema_version
+// корневого сообщения, см. inspector.protobufVersionField.
+// С 19000 по 19999 номера зарезервированы protobuf.
+const (
+	VersionNumber = 100
+	maxNumber     = 18999
+)
+
+type Definition struct {
+	Root string `json:"root"`
+	// Ключ корня, по нему строки нормализованных таблиц
+	// ссылаются на заказ.
+	PrimaryKey string `json:"primary_key"`
+	Types      []Type `json:"types"`
+
+	index map[string]*Type
+}
+
+type Type struct {
+	Name   string  `json:"name"`
+	Fields []Field `json:"fields"`
+}
+
+type Field struct {
+	// Ключ в JSON.
+	Key string `json:"key"`
+	// Номер поля в order.proto. Однажды выданный номер не меняется
+	// и не переиспользуется, порядок ключей на него не влияет.
+	Number int `json:"number"`
+	// Имя поля в Go.
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Format   string `json:"format,omitempty"`
+	MinItems int    `json:"min_items,omitempty"`
+	// Индекс по колонке в нормализованной таблице.
+	Index bool `json:"index,omitempty"`
+	// Комментарий переносится в схему инспектора.
+	Comment string `json:"comment,omitempty"`
+}
+
+// Elem возвращает тип объекта, на который ссылается поле,
+// и признак массива.
+func (f Field) Elem() (string, bool) {
+	if name, ok := strings.CutPrefix(f.Type, "[]"); ok {
+		return name, true
+	}
+	return f.Type, false
+}
+
+func (f Field) Scalar() bool {
+	return f.Type == TypeString || f.Type == TypeInt
+}
+
+//go:embed order.json
+var orderJSON []byte
+
+// Order — описание заказа из order.json.
+var Order = mustParse(orderJSON)
+
+func mustParse(b []byte) *Definition {
+	def, err := Parse(b)
+	if err != nil {
+		panic(err)
+	}
+	return def
+}
+
+// Parse разбирает и проверяет описание.
+func Parse(b []byte) (*Definition, error) {
+	def := &Definition{}
+	if err := json.Unmarshal(b, def); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+
+	def.index = make(map[string]*Type, len(def.Types))
+	for i := range def.Types {
+		t := &def.Types[i]
+		if _, ok := def.index[t.Name]; ok {
+			return nil, fmt.Errorf("schema: duplicate type %s", t.Name)
+		}
+		def.index[t.Name] = t
+	}
+	if _, ok := def.index[def.Root]; !ok {
+		return nil, fmt.Errorf("schema: unknown root type %s", def.Root)
+	}
+	if pk, ok := def.field(def.Root, def.PrimaryKey); !ok || pk.Type != TypeString {
+		return nil, fmt.Errorf("schema: primary key %q must be a string field of %s", def.PrimaryKey, def.Root)
+	}
+
+	for _, t := range def.Types {
+		if len(t.Fields) > 64 {
+			return nil, fmt.Errorf("schema: %s: more than 64 fields", t.Name)
+		}
+		keys := make(map[string]bool, len(t.Fields))
+		numbers := make(map[int]bool, len(t.Fields))
+		for _, f := range t.Fields {
+			if keys[f.Key] {
+				return nil, fmt.Errorf("schema: %s.%s: duplicate key", t.Name, f.Key)
+			}
+			keys[f.Key] = true
+			if err := def.checkField(f); err != nil {
+				return nil, fmt.Errorf("schema: %s.%s: %w", t.Name, f.Key, err)
+			}
+			switch {
+			case f.Number < 1 || f.Number > maxNumber:
+				return nil, fmt.Errorf("schema: %s.%s: number must be in 1..%d", t.Name, f.Key, maxNumber)
+			case numbers[f.Number]:
+				return nil, fmt.Errorf("schema: %s.%s: duplicate number %d", t.Name, f.Key, f.Number)
+			case t.Name == def.Root && f.Number == VersionNumber:
+				return nil, fmt.Errorf("schema: %s.%s: number %d is schema_version", t.Name, f.Key, f.Number)
+			}
+			numbers[f.Number] = true
+		}
+	}
+	return def, nil
+}
+
+func (def *Definition) checkField(f Field) error {
+	if f.Name == "" {
+		return fmt.Errorf("empty go name")
+	}
+	switch f.Format {
+	case "":
+	case FormatDateTime:
+		if f.Type != TypeString {
+			return fmt.Errorf("format %s requires string", f.Format)
+		}
+	case FormatUnixTime:
+		if f.Type != TypeInt {
+			return fmt.Errorf("format %s requires int", f.Format)
+		}
+	default:
+		return fmt.Errorf("unknown format %s", f.Format)
+	}
+	if f.Index && !f.Scalar() {
+		return fmt.Errorf("index on object")
+	}
+	if f.Scalar() {
+		if f.MinItems != 0 {
+			return fmt.Errorf("min_items on scalar")
+		}
+		return nil
+	}
+
+	name, array := f.Elem()
+	if _, ok := def.index[name]; !ok || name == def.Root {
+		return fmt.Errorf("unknown type %s", f.Type)
+	}
+	if f.Format != "" {
+		return fmt.Errorf("format on object")
+	}
+	if !array && f.MinItems != 0 {
+		return fmt.Errorf("min_items on object")
+	}
+	return nil
+}
+
+// Lookup возвращает тип по имени.
+func (def *Definition) Lookup(name string) (*Type, bool) {
+	t, ok := def.index[name]
+	return t, ok
+}
+
+func (def *Definition) field(typ, key string) (Field, bool) {
+	for _, f := range def.index[typ].Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// File — сгенерированный файл, путь относительно каталога пакета.
+type File struct {
+	Path     string
+	Generate func(def *Definition) ([]byte, error)
+}
+
+// Files перечисляет все, что генерирует schemagen.
+var Files = []File{
+	{"../repository/order_gen.go", GoTypes},
+	{"../inspector/scheme_gen.go", InspectorScheme},
+	{"order.schema.json", JSONSchema},
+	{"order.sql", SQLTables},
+	{"order.proto", ProtoFile},
+}
@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"os"
+	"testing"
+)
+
+// TestGenerated падает, если типы, схема инспектора или JSON Schema
+// разошлись с order.json или были исправлены вручную.
+func TestGenerated(t *testing.T) {
+	for _, f := range Files {
+		want, err := f.Generate(Order)
+		if err != nil {
+			t.Fatalf("%s: %v", f.Path, err)
+		}
+		got, err := os.ReadFile(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s is out of date, run go generate ./internal/schema", f.Path)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		def  string
+	}{
+		{"unknown root", `{"root":"X","types":[]}`},
+		{"unknown type", `{"root":"A","types":[{"name":"A","fields":[{"key":"b","name":"B","type":"B"}]}]}`},
+		{"root reference", `{"root":"A","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"[]A"}]}]}`},
+		{"duplicate key", `{"root":"A","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"int"},{"key":"a","name":"B","type":"int"}]}]}`},
+		{"format type", `{"root":"A","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"int","format":"date-time"}]}]}`},
+		{"primary key", `{"root":"A","primary_key":"b","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"string"}]}]}`},
+		{"index on object", `{"root":"A","primary_key":"a","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"string"},{"key":"b","name":"B","type":"B","index":true}]},{"name":"B","fields":[]}]}`},
+		{"unknown format", `{"root":"A","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"string","format":"email"}]}]}`},
+		{"no number", `{"root":"A","primary_key":"a","types":[{"name":"A","fields":[{"key":"a","name":"A","type":"string"}]}]}`},
+		{"duplicate number", `{"root":"A","primary_key":"a","types":[{"name":"A","fields":[{"key":"a","number":1,"name":"A","type":"string"},{"key":"b","number":1,"name":"B","type":"int"}]}]}`},
+		{"version number", `{"root":"A","primary_key":"a","types":[{"name":"A","fields":[{"key":"a","number":100,"name":"A","type":"string"}]}]}`},
+		{"reserved number", `{"root":"A","primary_key":"a","types":[{"name":"A","fields":[{"key":"a","number":19000,"name":"A","type":"string"}]}]}`},
+	} {
+		if _, err := Parse([]byte(tc.def)); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
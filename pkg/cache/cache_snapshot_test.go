@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCacheSnapshot(t *testing.T) {
+	c, _ := New(1)
+	defer c.Reset()
+
+	const items = 10000
+	for i := 0; i < items; i++ {
+		c.Set([]byte(fmt.Sprintf("key %d", i)), []byte(fmt.Sprintf("value %d", i)))
+	}
+	c.Set([]byte("empty"), nil)
+
+	var buf bytes.Buffer
+	if err := c.SaveTo(&buf); err != nil {
+		t.Fatalf("cannot save snapshot: %s", err)
+	}
+
+	c2, _ := New(1)
+	defer c2.Reset()
+	if err := c2.LoadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("cannot load snapshot: %s", err)
+	}
+
+	var s1, s2 Stats
+	c.UpdateStats(&s1)
+	c2.UpdateStats(&s2)
+	if s1.EntriesCount != s2.EntriesCount {
+		t.Fatalf("unexpected entries count; got %d; want %d", s2.EntriesCount, s1.EntriesCount)
+	}
+
+	for i := 0; i < items; i++ {
+		k := []byte(fmt.Sprintf("key %d", i))
+		v1, ok1 := c.HasGet(nil, k)
+		v2, ok2 := c2.HasGet(nil, k)
+		if ok1 != ok2 || string(v1) != string(v2) {
+			t.Fatalf("unexpected value for %q; got %q %v; want %q %v", k, v2, ok2, v1, ok1)
+		}
+	}
+	if _, ok := c2.HasGet(nil, []byte("empty")); !ok {
+		t.Fatalf("cannot find empty entry")
+	}
+
+	// Обрезанный снимок.
+	if err := c2.LoadFrom(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatalf("expected error on truncated snapshot")
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+)
+
+// SaveTo записывает все живые записи кеша в w.
+// Внутри бакета записи идут от старых к новым,
+// так LoadFrom вытеснит при переполнении старые, а не свежие.
+//
+// Формат записи тот же, что в chunks: длина ключа и значения по 2 байта, ключ, значение.
+func (c *Cache) SaveTo(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i := range c.buckets[:] {
+		if err := c.buckets[i].SaveTo(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadFrom добавляет в кеш записи, сохраненные SaveTo.
+func (c *Cache) LoadFrom(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var kvLenBuf [4]byte
+	var kv []byte
+
+	for {
+		if _, err := io.ReadFull(br, kvLenBuf[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		keyLen := int(kvLenBuf[0])<<8 | int(kvLenBuf[1])
+		valLen := int(kvLenBuf[2])<<8 | int(kvLenBuf[3])
+
+		if cap(kv) < keyLen+valLen {
+			kv = make([]byte, keyLen+valLen)
+		}
+		kv = kv[:keyLen+valLen]
+		if _, err := io.ReadFull(br, kv); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		c.Set(kv[:keyLen], kv[keyLen:])
+	}
+}
+
+func (b *bucket) SaveTo(w io.Writer) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	bGen := b.gen & ((1 << genSizeBits) - 1)
+
+	// age — позиция записи в кольцевом буфере от самой старой.
+	type entry struct {
+		age uint64
+		idx uint64
+	}
+	entries := make([]entry, 0, len(b.m))
+	for _, v := range b.m {
+		gen := v >> bucketSizeBits
+		idx := v & ((1 << bucketSizeBits) - 1)
+		switch {
+		case gen == bGen && idx < b.idx:
+			entries = append(entries, entry{age: maxBucketSize + idx, idx: idx})
+		case gen+1 == bGen && idx >= b.idx, gen == maxGen && bGen == 1 && idx >= b.idx:
+			entries = append(entries, entry{age: idx, idx: idx})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].age < entries[j].age
+	})
+
+	for _, e := range entries {
+		chunkIdx := e.idx / chunkSize
+		if chunkIdx >= uint64(len(b.chunks)) {
+			return errors.New("cache: corrupted bucket")
+		}
+		chunk := b.chunks[chunkIdx]
+		idx := e.idx % chunkSize
+		if idx+4 > uint64(len(chunk)) {
+			return errors.New("cache: corrupted bucket")
+		}
+		keyLen := (uint64(chunk[idx]) << 8) | uint64(chunk[idx+1])
+		valLen := (uint64(chunk[idx+2]) << 8) | uint64(chunk[idx+3])
+		end := idx + 4 + keyLen + valLen
+		if end > uint64(len(chunk)) {
+			return errors.New("cache: corrupted bucket")
+		}
+		if _, err := w.Write(chunk[idx:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}